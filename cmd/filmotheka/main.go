@@ -1,15 +1,33 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/axywe/filmotheka_vk/docs"
 	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/axywe/filmotheka_vk/internal/health"
+	"github.com/axywe/filmotheka_vk/internal/logging"
+	"github.com/axywe/filmotheka_vk/internal/metrics"
 	"github.com/axywe/filmotheka_vk/internal/middleware"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/internal/tracing"
 	"github.com/axywe/filmotheka_vk/pkg/actor"
 	"github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/role"
 	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/storage/memory"
+	"github.com/axywe/filmotheka_vk/pkg/storage/sqlstore"
+	"github.com/axywe/filmotheka_vk/pkg/user"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
@@ -23,24 +41,258 @@ import (
 // @in header
 // @name Authorization
 
-func main() {
-	db, err := storage.InitDB()
+// store is the persistence the handlers are wired to.
+type store interface {
+	movie.MovieStore
+	actor.ActorStore
+	auth.Store
+	user.UserStore
+	role.RoleStore
+}
+
+// backend is an opened storage backend. db, which the caller closes, and
+// engine are only set for the SQL backends.
+type backend struct {
+	store  store
+	db     *sql.DB
+	engine storage.Engine
+}
+
+// openStore opens the storage backend selected by cfg.Backend: "postgres",
+// "sqlite" or "memory". A positive rollback reverts that many migrations
+// instead of applying the pending ones.
+func openStore(ctx context.Context, cfg config.Config, rollback int) (backend, error) {
+	migrate := cfg.Storage.Migrate && rollback == 0
+	switch cfg.Storage.Backend {
+	case "postgres":
+		db, err := storage.InitDB(ctx, cfg.Database, migrate)
+		if err != nil {
+			return backend{}, err
+		}
+		if err := prepare(ctx, db, storage.Postgres, cfg.Storage, rollback); err != nil {
+			db.Close()
+			return backend{}, err
+		}
+		return backend{sqlstore.New(db, sqlstore.Postgres), db, storage.Postgres}, nil
+	case "sqlite":
+		db, err := storage.OpenSQLite(ctx, cfg.Storage.SQLitePath, migrate)
+		if err != nil {
+			return backend{}, err
+		}
+		if err := prepare(ctx, db, storage.SQLite, cfg.Storage, rollback); err != nil {
+			db.Close()
+			return backend{}, err
+		}
+		return backend{sqlstore.New(db, sqlstore.SQLite), db, storage.SQLite}, nil
+	case "memory":
+		if rollback > 0 {
+			return backend{}, fmt.Errorf("the memory backend has no migrations to roll back")
+		}
+		s := memory.New()
+		if !cfg.Storage.Seed {
+			return backend{store: s}, nil
+		}
+		// The same demo accounts as seed.sql: admin/admin and user/user.
+		for _, u := range []auth.User{
+			{Username: "admin", Password: "$2a$10$NjIPpHePTDy5hJs/JmX90uWxWT5jOqrw0OyrBg88lmiQvlHQHbAXu", Role: auth.RoleAdmin},
+			{Username: "user", Password: "$2a$10$ajvqHTuI3ixFdkI2WUJrF.KPPp2etsdgtj/jccMH0yek7W8JZK3P6", Role: auth.RoleViewer},
+		} {
+			if _, err := s.AddUser(ctx, u); err != nil {
+				return backend{}, err
+			}
+		}
+		return backend{store: s}, nil
+	default:
+		return backend{}, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// prepare rolls back or seeds a freshly opened SQL database as configured.
+func prepare(ctx context.Context, db *sql.DB, engine storage.Engine, cfg config.Storage, rollback int) error {
+	if rollback > 0 {
+		return storage.MigrateDown(ctx, db, engine, rollback)
+	}
+	if cfg.Seed {
+		return storage.Seed(ctx, db)
+	}
+	return nil
+}
+
+// routes registers the API and the health endpoints on a fresh mux. keys
+// signs and verifies the tokens.
+func routes(cfg config.Config, keys *tokens.Keyring, store store, healthHandler *health.Handler) *http.ServeMux {
+	actorHandler := actor.NewHandler(store)
+	movieHandler := movie.NewHandler(store)
+	authority := tokens.NewAuthority(keys, cfg.Auth)
+	authHandler := auth.NewHandler(store, authority, cfg.Auth.RefreshTTL)
+	userHandler := user.NewHandler(store, cfg.Auth)
+	roleHandler := role.NewHandler(store)
+
+	// api bounds the requests that reach the storage with a deadline.
+	api := func(h http.Handler) http.Handler {
+		return middleware.Deadline(cfg.Server.RequestTimeout, h)
+	}
+	// authenticated lets through any valid token, can only those whose role
+	// grants permission.
+	authenticated := func(h http.HandlerFunc) http.Handler {
+		return api(middleware.Authenticate(authority, store, h))
+	}
+	can := func(permission auth.Permission, h http.Handler) http.Handler {
+		return api(middleware.RequirePermission(authority, store, permission, h))
+	}
+	actorItem := http.HandlerFunc(actorHandler.ServeItem)
+	movieItem := http.HandlerFunc(movieHandler.ServeItem)
+
+	mux := http.NewServeMux()
+	// handle registers h with its requests counted, timed and traced under
+	// pattern.
+	handle := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, metrics.Instrument(pattern, tracing.Middleware(pattern, h)))
+	}
+	handle("/swagger/", httpSwagger.WrapHandler)
+	handle("GET /actors", can(auth.ActorsRead, actorHandler))
+	handle("POST /actors", can(auth.ActorsWrite, actorHandler))
+	handle("PUT /actors", can(auth.ActorsWrite, actorHandler))
+	handle("DELETE /actors", can(auth.ActorsDelete, actorHandler))
+	handle("GET /actors/{id}", can(auth.ActorsRead, actorItem))
+	handle("PUT /actors/{id}", can(auth.ActorsWrite, actorItem))
+	handle("PATCH /actors/{id}", can(auth.ActorsWrite, actorItem))
+	handle("DELETE /actors/{id}", can(auth.ActorsDelete, actorItem))
+	handle("GET /movies", can(auth.MoviesRead, movieHandler))
+	handle("POST /movies", can(auth.MoviesWrite, movieHandler))
+	handle("PUT /movies", can(auth.MoviesWrite, movieHandler))
+	handle("DELETE /movies", can(auth.MoviesDelete, movieHandler))
+	handle("GET /movies/{id}", can(auth.MoviesRead, movieItem))
+	handle("PUT /movies/{id}", can(auth.MoviesWrite, movieItem))
+	handle("PATCH /movies/{id}", can(auth.MoviesWrite, movieItem))
+	handle("DELETE /movies/{id}", can(auth.MoviesDelete, movieItem))
+
+	handle("/auth", api(authHandler))
+	handle("POST /auth/refresh", api(http.HandlerFunc(authHandler.Refresh)))
+	handle("GET /.well-known/jwks.json", http.HandlerFunc(keys.ServeJWKS))
+	handle("POST /auth/logout", authenticated(authHandler.Logout))
+
+	handle("POST /users", api(http.HandlerFunc(userHandler.Register)))
+	handle("GET /users", can(auth.UsersRead, http.HandlerFunc(userHandler.List)))
+	handle("GET /users/me", authenticated(userHandler.Me))
+	handle("PUT /users/me/password", authenticated(userHandler.ChangePassword))
+	handle("PATCH /users/{id}", can(auth.UsersWrite, http.HandlerFunc(userHandler.Update)))
+	handle("POST /users/invites", can(auth.UsersInvite, http.HandlerFunc(userHandler.CreateInvite)))
+
+	handle("GET /roles", can(auth.RolesRead, http.HandlerFunc(roleHandler.List)))
+	handle("GET /roles/permissions", can(auth.RolesRead, http.HandlerFunc(roleHandler.Permissions)))
+	handle("GET /roles/{id}", can(auth.RolesRead, http.HandlerFunc(roleHandler.Get)))
+	handle("POST /roles", can(auth.RolesWrite, http.HandlerFunc(roleHandler.Create)))
+	handle("PUT /roles/{id}", can(auth.RolesWrite, http.HandlerFunc(roleHandler.Replace)))
+	handle("DELETE /roles/{id}", can(auth.RolesWrite, http.HandlerFunc(roleHandler.Delete)))
+
+	handle("GET /healthz", http.HandlerFunc(healthHandler.Live))
+	handle("GET /readyz", api(http.HandlerFunc(healthHandler.Ready)))
+	handle("GET /version", http.HandlerFunc(healthHandler.Version))
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
+
+// serve runs srv until ctx is done, then lets the requests in flight finish
+// for at most timeout.
+func serve(ctx context.Context, srv *http.Server, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "addr", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining requests in flight")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
+
+func run() error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	rollback := fs.Int("rollback", 0, "revert the given number of migrations and exit")
+	cfg, err := config.Load(fs, os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("invalid configuration: %w", err)
 	}
-	defer db.Close()
 
-	actorHandler := actor.NewHandler(db)
-	movieHandler := movie.NewHandler(db)
-	tokenGenerator := &auth.JWTTokenGenerator{}
-	authHandler := auth.NewHandler(db, tokenGenerator)
+	logger := logging.New(os.Stderr, cfg.Log.SlogLevel())
+	slog.SetDefault(logger)
 
-	http.Handle("/swagger/", httpSwagger.WrapHandler)
-	http.Handle("/actors", middleware.RoleCheckMiddleware(actorHandler))
-	http.Handle("/movies", middleware.RoleCheckMiddleware(movieHandler))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	http.HandleFunc("/auth", authHandler.ServeHTTP)
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+	defer func() {
+		// Flush the spans of the last requests, which ctx no longer allows.
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Warn("flushing traces", "error", err)
+		}
+	}()
+
+	keys, err := tokens.LoadKeyring(cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("JWT keys: %w", err)
+	}
+	if cfg.Auth.SigningKey == "" {
+		slog.Warn("no JWT signing key configured, tokens are signed with a temporary key and expire on restart")
+	}
 
-	log.Println("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	b, err := openStore(ctx, cfg, *rollback)
+	if err != nil {
+		return err
+	}
+	if db := b.db; db != nil {
+		// serve returns once the server has drained, so no request outlives
+		// the pool.
+		defer func() {
+			db.Close()
+			slog.Info("database connections closed")
+		}()
+	}
+	if *rollback > 0 {
+		slog.Info("reverted migrations", "count", *rollback)
+		return nil
+	}
+	checks := map[string]health.Check{}
+	if b.db != nil {
+		metrics.RegisterDB(b.db, string(b.engine))
+		monitor := storage.NewMonitor(b.db, cfg.Database.HealthInterval)
+		go monitor.Run(ctx)
+		checks["database"] = func(context.Context) error { return monitor.Err() }
+		checks["migrations"] = func(ctx context.Context) error { return storage.CheckMigrations(ctx, b.db, b.engine) }
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr(),
+		Handler:           logging.Middleware(logger, routes(cfg, keys, b.store, health.NewHandler(checks))),
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	return serve(ctx, srv, cfg.Server.ShutdownTimeout)
+}
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("exiting", "error", err)
+		os.Exit(1)
+	}
 }
@@ -1,13 +1,15 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/axywe/filmotheka_vk/internal/metrics"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
 	"github.com/axywe/filmotheka_vk/util"
-	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -16,37 +18,59 @@ type Credentials struct {
 	Password string `json:"password"`
 }
 
+// User is an account allowed to obtain tokens. Password holds the bcrypt
+// hash of the password and Role the ID of its role. Disabled accounts cannot
+// obtain tokens.
+type User struct {
+	ID       int
+	Username string
+	Password string
+	Role     int
+	Disabled bool
+}
+
+// UserStore looks up accounts. Implementations report an unknown username
+// or ID with storage.ErrNotFound.
+type UserStore interface {
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUserByID(ctx context.Context, id int) (User, error)
+}
+
+// Store is the persistence of the handler.
+type Store interface {
+	UserStore
+	TokenStore
+}
+
 type Handler struct {
-	db             *sql.DB
+	store          Store
 	tokenGenerator TokenGenerator
+	refreshTTL     time.Duration
 }
 
-func NewHandler(db *sql.DB, tokenGen TokenGenerator) *Handler {
+// NewHandler returns a handler issuing access tokens with tokenGen and refresh
+// tokens that expire after refreshTTL.
+func NewHandler(store Store, tokenGen TokenGenerator, refreshTTL time.Duration) *Handler {
 	return &Handler{
-		db:             db,
+		store:          store,
 		tokenGenerator: tokenGen,
+		refreshTTL:     refreshTTL,
 	}
 }
 
+// TokenResponse carries a short-lived access token, to be sent as a bearer
+// token, and the refresh token to exchange for the next pair at
+// /auth/refresh.
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
 }
 
+// TokenGenerator issues the access tokens, see tokens.Authority.
 type TokenGenerator interface {
 	GenerateToken(userID int, role int) (string, error)
 }
 
-type JWTTokenGenerator struct{}
-
-func (j *JWTTokenGenerator) GenerateToken(userID int, role int) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": userID,
-		"role":   role,
-		"exp":    time.Now().Add(time.Hour * 72).Unix(),
-	})
-	return token.SignedString([]byte("your_secret_key"))
-}
-
 // @Summary Authentication Processing
 // @Description Processes POST user authentication requests and generates JWT tokens.
 // @Tags Auth
@@ -56,6 +80,7 @@ func (j *JWTTokenGenerator) GenerateToken(userID int, role int) (string, error)
 // @Success 200 {object} TokenResponse "Successful authentication"
 // @Failure 400 {object} util.ErrorResponse "Invalid input data"
 // @Failure 401 {object} util.ErrorResponse "User not found or invalid credentials"
+// @Failure 403 {object} util.ErrorResponse "Account disabled"
 // @Failure 405 {object} util.ErrorResponse "Only the POST method is allowed"
 // @Failure 500 {object} util.ErrorResponse "Server error"
 // @Router /auth [post]
@@ -67,34 +92,33 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	var creds Credentials
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		metrics.AuthFailed(metrics.Login, "malformed_request")
 		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var user struct {
-		ID       int    `json:"id"`
-		Password string `json:"password"`
-		Role     int    `json:"role"`
-	}
-	if err := h.db.QueryRow("SELECT id, password, role FROM users WHERE username = $1", creds.Username).Scan(&user.ID, &user.Password, &user.Role); err != nil {
-		if err == sql.ErrNoRows {
+	user, err := h.store.GetUserByUsername(r.Context(), creds.Username)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			metrics.AuthFailed(metrics.Login, "unknown_user")
 			util.SendJSONError(w, r, "User not found", http.StatusUnauthorized)
 		} else {
+			metrics.AuthFailed(metrics.Login, "store_error")
 			util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
 		}
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
+		metrics.AuthFailed(metrics.Login, "wrong_password")
 		util.SendJSONError(w, r, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
-
-	tokenString, err := h.tokenGenerator.GenerateToken(user.ID, user.Role)
-	if err != nil {
-		util.SendJSONError(w, r, "Error while signing the token", http.StatusInternalServerError)
+	if user.Disabled {
+		metrics.AuthFailed(metrics.Login, "disabled_user")
+		util.SendJSONError(w, r, "Account disabled", http.StatusForbidden)
 		return
 	}
 
-	util.SendJSONResponse(w, r, TokenResponse{Token: tokenString}, http.StatusOK)
+	h.issue(w, r, metrics.Login, user, "")
 }
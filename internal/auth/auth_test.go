@@ -2,15 +2,21 @@ package auth_test
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	auth "github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/axywe/filmotheka_vk/internal/middleware"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/storage/memory"
+	"github.com/axywe/filmotheka_vk/pkg/storage/sqlstore"
 	testutils "github.com/axywe/filmotheka_vk/testutils"
 	"golang.org/x/crypto/bcrypt"
 
@@ -18,6 +24,19 @@ import (
 	_ "github.com/lib/pq"
 )
 
+var ctx = context.Background()
+
+var testAuth = config.Auth{TokenTTL: time.Hour, RefreshTTL: 24 * time.Hour, Issuer: "filmotheka", Audience: "filmotheka"}
+
+// testAuthority signs the tokens of the tests with a generated Ed25519 key.
+var testAuthority = func() *tokens.Authority {
+	keys, err := tokens.LoadKeyring(testAuth)
+	if err != nil {
+		panic(err)
+	}
+	return tokens.NewAuthority(keys, testAuth)
+}()
+
 type ErrorResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -27,14 +46,14 @@ func (m *ErrorResponse) GenerateToken(userID int, role int) (string, error) {
 	return "", errors.New(m.Message)
 }
 
-func setupTestUser(db *sql.DB, t *testing.T) {
+func setupTestUser(store *memory.Store, t *testing.T) {
 	password := "password123"
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		t.Fatalf("Failed to hash password: %v", err)
 	}
 
-	_, err = db.Exec("INSERT INTO users (username, password, role) VALUES ($1, $2, $3)", "testuser", string(hashedPassword), 1)
+	_, err = store.AddUser(ctx, auth.User{Username: "testuser", Password: string(hashedPassword), Role: 1})
 	if err != nil {
 		t.Fatalf("Failed to insert test user: %v", err)
 	}
@@ -44,8 +63,7 @@ func TestBrokenAuthHandler(t *testing.T) {
 	db := testutils.BrokenSetupDB(t)
 	defer db.Close()
 
-	tokenGenerator := &auth.JWTTokenGenerator{}
-	h := auth.NewHandler(db, tokenGenerator)
+	h := auth.NewHandler(sqlstore.New(db, sqlstore.Postgres), testAuthority, testAuth.RefreshTTL)
 
 	creds := auth.Credentials{
 		Username: "testuser",
@@ -72,12 +90,10 @@ func TestBrokenAuthHandler(t *testing.T) {
 }
 
 func TestAuthHandler(t *testing.T) {
-	db := testutils.SetupDB(t)
-	setupTestUser(db, t)
+	store := testutils.SetupStore(t)
+	setupTestUser(store, t)
 
-	defer db.Close()
-	tokenGenerator := &auth.JWTTokenGenerator{}
-	h := auth.NewHandler(db, tokenGenerator)
+	h := auth.NewHandler(store, testAuthority, testAuth.RefreshTTL)
 
 	creds := auth.Credentials{
 		Username: "testuser",
@@ -133,7 +149,9 @@ func TestAuthHandler(t *testing.T) {
 	if tokenResp.Token == "" {
 		t.Errorf("Expected non-empty token")
 	}
-	teardownTestUser(db, t)
+
+	// A store without the test user.
+	h = auth.NewHandler(testutils.SetupStore(t), testAuthority, testAuth.RefreshTTL)
 
 	newCreds := auth.Credentials{
 		Username: "testuser",
@@ -172,13 +190,6 @@ func TestAuthHandler(t *testing.T) {
 	}
 }
 
-func teardownTestUser(db *sql.DB, t *testing.T) {
-	_, err := db.Exec("DELETE FROM users WHERE username = $1", "testuser")
-	if err != nil {
-		t.Fatalf("Failed to delete test user: %v", err)
-	}
-}
-
 func TestHandler_ServeHTTP_InternalServerError(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -187,12 +198,12 @@ func TestHandler_ServeHTTP_InternalServerError(t *testing.T) {
 	defer db.Close()
 
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
-	mock.ExpectQuery("SELECT id, password, role FROM users WHERE username = \\$1").
+	mock.ExpectQuery("SELECT id, password, role, disabled FROM users WHERE username = \\$1").
 		WithArgs("testuser").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "role"}).
-			AddRow(1, string(hashedPassword), 1))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "role", "disabled"}).
+			AddRow(1, string(hashedPassword), 1, false))
 
-	handler := auth.NewHandler(db, &ErrorResponse{Code: http.StatusInternalServerError, Message: "token generation failed"})
+	handler := auth.NewHandler(sqlstore.New(db, sqlstore.Postgres), &ErrorResponse{Code: http.StatusInternalServerError, Message: "token generation failed"}, testAuth.RefreshTTL)
 
 	requestBody := bytes.NewBufferString(`{"username":"testuser","password":"password"}`)
 	req, err := http.NewRequest("POST", "/auth", requestBody)
@@ -219,7 +230,7 @@ func TestHandler_ServeHTTP_BadRequest(t *testing.T) {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
-	handler := auth.NewHandler(db, &auth.JWTTokenGenerator{})
+	handler := auth.NewHandler(sqlstore.New(db, sqlstore.Postgres), testAuthority, testAuth.RefreshTTL)
 
 	requestBody := bytes.NewBufferString(`{"username":"testuser", "password":`)
 	req, err := http.NewRequest("POST", "/auth", requestBody)
@@ -239,3 +250,156 @@ func TestHandler_ServeHTTP_BadRequest(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+// post sends body to handler and decodes the tokens it answers with.
+func post(t *testing.T, handler http.Handler, path, accessToken, body string) (int, auth.TokenResponse) {
+	req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var tokens auth.TokenResponse
+	if rr.Code == http.StatusOK {
+		json.Unmarshal(rr.Body.Bytes(), &tokens)
+	}
+	return rr.Code, tokens
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	store := testutils.SetupStore(t)
+	setupTestUser(store, t)
+	h := auth.NewHandler(store, testAuthority, testAuth.RefreshTTL)
+	refresh := http.HandlerFunc(h.Refresh)
+
+	status, login := post(t, h, "/auth", "", `{"username":"testuser","password":"password123"}`)
+	if status != http.StatusOK || login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("Login failed: status %v, tokens %+v", status, login)
+	}
+
+	status, rotated := post(t, refresh, "/auth/refresh", "", `{"refreshToken":"`+login.RefreshToken+`"}`)
+	if status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if rotated.RefreshToken == login.RefreshToken || rotated.Token == login.Token {
+		t.Errorf("Expected new tokens, got %+v", rotated)
+	}
+
+	if status, _ := post(t, refresh, "/auth/refresh", "", `{"refreshToken":"unknown"}`); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for an unknown token: got %v want %v", status, http.StatusUnauthorized)
+	}
+	if status, _ := post(t, refresh, "/auth/refresh", "", `{"refreshToken":`); status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for a malformed request: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	// Reusing the first token gives the whole family away.
+	if status, _ := post(t, refresh, "/auth/refresh", "", `{"refreshToken":"`+login.RefreshToken+`"}`); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for a reused token: got %v want %v", status, http.StatusUnauthorized)
+	}
+	if status, _ := post(t, refresh, "/auth/refresh", "", `{"refreshToken":"`+rotated.RefreshToken+`"}`); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for a token of a revoked family: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshRejectsExpiredTokens(t *testing.T) {
+	store := testutils.SetupStore(t)
+	setupTestUser(store, t)
+	user, err := store.GetUserByUsername(ctx, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to look up test user: %v", err)
+	}
+	err = store.SaveRefreshToken(ctx, auth.RefreshToken{Hash: auth.HashToken("expired"), FamilyID: "family", UserID: user.ID, ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Failed to save refresh token: %v", err)
+	}
+
+	h := auth.NewHandler(store, testAuthority, testAuth.RefreshTTL)
+	if status, _ := post(t, http.HandlerFunc(h.Refresh), "/auth/refresh", "", `{"refreshToken":"expired"}`); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestDisabledUserCannotObtainTokens(t *testing.T) {
+	store := testutils.SetupStore(t)
+	setupTestUser(store, t)
+	h := auth.NewHandler(store, testAuthority, testAuth.RefreshTTL)
+
+	_, login := post(t, h, "/auth", "", `{"username":"testuser","password":"password123"}`)
+	user, _ := store.GetUserByUsername(ctx, "testuser")
+	if _, err := store.UpdateUser(ctx, user.ID, func(u *auth.User) error { u.Disabled = true; return nil }); err != nil {
+		t.Fatalf("Failed to disable test user: %v", err)
+	}
+
+	if status, _ := post(t, h, "/auth", "", `{"username":"testuser","password":"password123"}`); status != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code for login: got %v want %v", status, http.StatusForbidden)
+	}
+	body := `{"refreshToken":"` + login.RefreshToken + `"}`
+	if status, _ := post(t, http.HandlerFunc(h.Refresh), "/auth/refresh", "", body); status != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code for refresh: got %v want %v", status, http.StatusForbidden)
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	store := testutils.SetupStore(t)
+	setupTestUser(store, t)
+	h := auth.NewHandler(store, testAuthority, testAuth.RefreshTTL)
+	logout := middleware.Authenticate(testAuthority, store, http.HandlerFunc(h.Logout))
+	protected := middleware.RequirePermission(testAuthority, store, auth.MoviesRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	_, login := post(t, h, "/auth", "", `{"username":"testuser","password":"password123"}`)
+	if status, _ := post(t, protected, "/movies", login.Token, ""); status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code before logout: got %v want %v", status, http.StatusOK)
+	}
+
+	if status, _ := post(t, logout, "/auth/logout", login.Token, `{"refreshToken":"unknown"}`); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for an unknown refresh token: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	// Presenting another account's refresh token is rejected and leaves the
+	// token usable by its owner.
+	other, err := store.AddUser(ctx, auth.User{Username: "otheruser", Password: "hash", Role: auth.RoleViewer})
+	if err != nil {
+		t.Fatalf("Failed to add other user: %v", err)
+	}
+	otherToken, _ := testAuthority.GenerateToken(other.ID, other.Role)
+	if status, _ := post(t, logout, "/auth/logout", otherToken, `{"refreshToken":"`+login.RefreshToken+`"}`); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for another account's refresh token: got %v want %v", status, http.StatusUnauthorized)
+	}
+	if stored, _ := store.GetRefreshToken(ctx, auth.HashToken(login.RefreshToken)); stored.Used || stored.Revoked {
+		t.Errorf("another account's logout used or revoked the refresh token: %+v", stored)
+	}
+	if status, _ := post(t, logout, "/auth/logout", login.Token, `{"refreshToken":"`+login.RefreshToken+`"}`); status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if status, _ := post(t, protected, "/movies", login.Token, ""); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for a revoked access token: got %v want %v", status, http.StatusUnauthorized)
+	}
+	if status, _ := post(t, http.HandlerFunc(h.Refresh), "/auth/refresh", "", `{"refreshToken":"`+login.RefreshToken+`"}`); status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code for a revoked refresh token: got %v want %v", status, http.StatusUnauthorized)
+	}
+}
+
+func TestCheckWithinOwn(t *testing.T) {
+	store := memory.New()
+	const editor, moderator = 3, 4
+	moderatorRole, _ := store.GetRole(ctx, moderator)
+	editorRole, _ := store.GetRole(ctx, editor)
+
+	if err := auth.CheckWithinOwn(ctx, store, moderator, editorRole); err != nil {
+		t.Errorf("Expected the moderator role to cover the editor role, got %v", err)
+	}
+	if err := auth.CheckWithinOwn(ctx, store, editor, moderatorRole); !errors.Is(err, auth.ErrBeyondOwn) {
+		t.Errorf("Expected ErrBeyondOwn for the editor role, got %v", err)
+	}
+	if err := auth.CheckWithinOwn(ctx, store, 99, auth.Role{}); err != nil {
+		t.Errorf("Expected an unknown role to cover a role without permissions, got %v", err)
+	}
+	if err := auth.CheckWithinOwn(ctx, store, 99, editorRole); !errors.Is(err, auth.ErrBeyondOwn) {
+		t.Errorf("Expected an unknown role to grant nothing, got %v", err)
+	}
+}
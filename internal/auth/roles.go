@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+// Permission allows one kind of operation. Routes declare the permission they
+// need; roles grant sets of permissions.
+type Permission string
+
+const (
+	MoviesRead   Permission = "movies:read"
+	MoviesWrite  Permission = "movies:write"
+	MoviesDelete Permission = "movies:delete"
+	ActorsRead   Permission = "actors:read"
+	ActorsWrite  Permission = "actors:write"
+	ActorsDelete Permission = "actors:delete"
+	UsersRead    Permission = "users:read"
+	UsersWrite   Permission = "users:write"
+	UsersInvite  Permission = "users:invite"
+	RolesRead    Permission = "roles:read"
+	RolesWrite   Permission = "roles:write"
+)
+
+// Permissions lists every permission known to the API.
+var Permissions = []Permission{
+	MoviesRead, MoviesWrite, MoviesDelete,
+	ActorsRead, ActorsWrite, ActorsDelete,
+	UsersRead, UsersWrite, UsersInvite,
+	RolesRead, RolesWrite,
+}
+
+// KnownPermission reports whether p is one of Permissions.
+func KnownPermission(p Permission) bool {
+	for _, known := range Permissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// IDs of the built-in roles, which migration 0004 creates next to editor and
+// moderator. The admin role cannot be changed or deleted, so that someone can
+// always manage the others; viewer is the role of the accounts registered
+// without an invite and cannot be deleted.
+const (
+	RoleAdmin  = 1
+	RoleViewer = 2
+)
+
+// Role is a named set of permissions, stored so that administrators can
+// define roles without a redeploy. Accounts and tokens refer to roles by ID.
+type Role struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// Can reports whether the role grants p.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range r.Permissions {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether r grants every permission of other.
+func (r Role) Covers(other Role) bool {
+	for _, p := range other.Permissions {
+		if !r.Can(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrBeyondOwn rejects granting, changing or removing permissions beyond the
+// caller's own role, which would let accounts escalate their privileges or
+// act against more privileged ones.
+var ErrBeyondOwn = errors.New("cannot grant permissions beyond your own")
+
+// LoadRole returns the role with the given ID, or a role granting nothing if
+// there is no such role.
+func LoadRole(ctx context.Context, store RoleStore, id int) (Role, error) {
+	r, err := store.GetRole(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Role{ID: id}, nil
+	}
+	return r, err
+}
+
+// CheckWithinOwn returns ErrBeyondOwn unless the role with ID own covers
+// role.
+func CheckWithinOwn(ctx context.Context, store RoleStore, own int, role Role) error {
+	ownRole, err := LoadRole(ctx, store, own)
+	if err != nil {
+		return err
+	}
+	if !ownRole.Covers(role) {
+		return ErrBeyondOwn
+	}
+	return nil
+}
+
+// RoleStore looks up roles. Implementations report an unknown ID with
+// storage.ErrNotFound.
+type RoleStore interface {
+	GetRole(ctx context.Context, id int) (Role, error)
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/logging"
+	"github.com/axywe/filmotheka_vk/internal/metrics"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/util"
+)
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token
+// is kept. The tokens rotated from the same login form a family, which is
+// revoked as a whole once one of its used tokens is presented again.
+type RefreshToken struct {
+	Hash      string
+	FamilyID  string
+	UserID    int
+	ExpiresAt time.Time
+	// Used is set once the token has been exchanged for a new one.
+	Used    bool
+	Revoked bool
+}
+
+// Denylist tells whether an access token was revoked before it expired.
+type Denylist interface {
+	AccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// TokenStore keeps the refresh tokens and the revoked access tokens.
+// Implementations may drop both once they have expired.
+type TokenStore interface {
+	Denylist
+	SaveRefreshToken(ctx context.Context, t RefreshToken) error
+	// GetRefreshToken returns the token with hash without using it. Unknown
+	// hashes are reported with storage.ErrNotFound.
+	GetRefreshToken(ctx context.Context, hash string) (RefreshToken, error)
+	// UseRefreshToken marks the token with hash as used and returns it as it
+	// was before, so that a second use can be told from the first. Unknown
+	// hashes are reported with storage.ErrNotFound.
+	UseRefreshToken(ctx context.Context, hash string) (RefreshToken, error)
+	RevokeTokenFamily(ctx context.Context, familyID string) error
+	// RevokeAccessToken denies the access token jti until expiresAt.
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// newRefreshToken returns a random 256-bit refresh token.
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hash under which a refresh token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue responds with a new access token for user and a refresh token in
+// familyID, or in a new family if familyID is empty.
+func (h *Handler) issue(w http.ResponseWriter, r *http.Request, stage string, user User, familyID string) {
+	accessToken, err := h.tokenGenerator.GenerateToken(user.ID, user.Role)
+	if err != nil {
+		metrics.AuthFailed(stage, "signing_error")
+		util.SendJSONError(w, r, "Error while signing the token", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err == nil && familyID == "" {
+		familyID, err = tokens.NewID()
+	}
+	if err != nil {
+		metrics.AuthFailed(stage, "signing_error")
+		util.SendJSONError(w, r, "Error while signing the token", http.StatusInternalServerError)
+		return
+	}
+	err = h.store.SaveRefreshToken(r.Context(), RefreshToken{
+		Hash:      HashToken(refreshToken),
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(h.refreshTTL).UTC(),
+	})
+	if err != nil {
+		metrics.AuthFailed(stage, "store_error")
+		util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	metrics.AuthSucceeded(stage)
+
+	util.SendJSONResponse(w, r, TokenResponse{Token: accessToken, RefreshToken: refreshToken}, http.StatusOK)
+}
+
+// @Summary Token refresh
+// @Description Exchanges a refresh token for a new access token and a new refresh token. Each refresh token
+// @Description can be used once: presenting a used one again revokes every token descending from the same login.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param refreshToken body RefreshRequest true "Refresh token"
+// @Success 200 {object} TokenResponse "New tokens"
+// @Failure 400 {object} util.ErrorResponse "Invalid input data"
+// @Failure 401 {object} util.ErrorResponse "Invalid, expired, revoked or reused refresh token"
+// @Failure 403 {object} util.ErrorResponse "Account disabled"
+// @Failure 500 {object} util.ErrorResponse "Server error"
+// @Router /auth/refresh [post]
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		metrics.AuthFailed(metrics.Refresh, "malformed_request")
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.store.UseRefreshToken(r.Context(), HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			metrics.AuthFailed(metrics.Refresh, "unknown_token")
+			util.SendJSONError(w, r, "Invalid refresh token", http.StatusUnauthorized)
+		} else {
+			metrics.AuthFailed(metrics.Refresh, "store_error")
+			util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch {
+	case token.Revoked:
+		metrics.AuthFailed(metrics.Refresh, "revoked_token")
+		util.SendJSONError(w, r, "Refresh token revoked", http.StatusUnauthorized)
+		return
+	case token.Used:
+		// Either the client or someone who stole the token used it before:
+		// neither can be trusted with its descendants.
+		logging.FromContext(r.Context()).Warn("refresh token reused, revoking its family", "user_id", token.UserID)
+		if err := h.store.RevokeTokenFamily(r.Context(), token.FamilyID); err != nil {
+			metrics.AuthFailed(metrics.Refresh, "store_error")
+			util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
+			return
+		}
+		metrics.AuthFailed(metrics.Refresh, "reused_token")
+		util.SendJSONError(w, r, "Refresh token reused", http.StatusUnauthorized)
+		return
+	case !time.Now().Before(token.ExpiresAt):
+		metrics.AuthFailed(metrics.Refresh, "expired_token")
+		util.SendJSONError(w, r, "Refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	// The account is read again so that a change of its role, or its
+	// disabling, applies from the next refresh.
+	user, err := h.store.GetUserByID(r.Context(), token.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			metrics.AuthFailed(metrics.Refresh, "unknown_user")
+			util.SendJSONError(w, r, "User not found", http.StatusUnauthorized)
+		} else {
+			metrics.AuthFailed(metrics.Refresh, "store_error")
+			util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if user.Disabled {
+		metrics.AuthFailed(metrics.Refresh, "disabled_user")
+		util.SendJSONError(w, r, "Account disabled", http.StatusForbidden)
+		return
+	}
+
+	h.issue(w, r, metrics.Refresh, user, token.FamilyID)
+}
+
+// @Summary Logout
+// @Description Revokes the access token of the request and, if given, the refresh token together with every
+// @Description token descending from the same login.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param refreshToken body RefreshRequest false "Refresh token"
+// @Success 200 {string} string "Logged out"
+// @Failure 400 {object} util.ErrorResponse "Invalid input data"
+// @Failure 401 {object} util.ErrorResponse "Invalid access or refresh token"
+// @Failure 500 {object} util.ErrorResponse "Server error"
+// @Security ApiKeyAuth
+// @Router /auth/logout [post]
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	access, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken != "" {
+		// The token is only looked up: using someone else's token here would
+		// make its owner's next refresh look like a reuse.
+		token, err := h.store.GetRefreshToken(r.Context(), HashToken(req.RefreshToken))
+		if errors.Is(err, storage.ErrNotFound) || err == nil && token.UserID != access.UserID() {
+			util.SendJSONError(w, r, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		if err == nil {
+			err = h.store.RevokeTokenFamily(r.Context(), token.FamilyID)
+		}
+		if err != nil {
+			util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.store.RevokeAccessToken(r.Context(), access.ID, access.ExpiresAt.Time); err != nil {
+		util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	util.SendJSONResponse(w, r, "Logged out", http.StatusOK)
+}
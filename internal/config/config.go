@@ -0,0 +1,448 @@
+// Package config assembles the application settings. Each layer overrides the
+// previous one: built-in defaults, an optional JSON or YAML file, environment
+// variables and command line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the application.
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Storage  Storage  `yaml:"storage"`
+	Database Database `yaml:"database"`
+	Auth     Auth     `yaml:"auth"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+}
+
+// Log configures the JSON log written to standard error.
+type Log struct {
+	// Level is "debug", "info", "warn" or "error". SQL statements are
+	// logged at debug.
+	Level string `yaml:"level"`
+}
+
+// SlogLevel is the log/slog counterpart of Level.
+func (l Log) SlogLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(l.Level))
+	return level
+}
+
+// Tracing configures the OpenTelemetry traces of the requests and of the SQL
+// statements they run.
+type Tracing struct {
+	// Exporter is "none", "stdout" or "otlp".
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the URL of the OTLP/HTTP collector the otlp exporter sends
+	// the spans to.
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the fraction of the traces started here that are
+	// recorded. Traces continued from a traceparent header follow the
+	// sampling decision of the caller.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Server configures the HTTP listener.
+type Server struct {
+	Port int `yaml:"port"`
+
+	// Limits on a single connection, see the matching fields of http.Server.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+	// RequestTimeout bounds the work done for a single API request,
+	// database queries included. It must be shorter than WriteTimeout for
+	// the timeout to reach the client.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests may drain after
+	// SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// Addr is the address the server listens on.
+func (s Server) Addr() string {
+	return ":" + strconv.Itoa(s.Port)
+}
+
+// Storage selects the storage backend and how its schema is prepared.
+type Storage struct {
+	// Backend is "postgres", "sqlite" or "memory".
+	Backend    string `yaml:"backend"`
+	SQLitePath string `yaml:"sqlite_path"`
+	// Migrate applies the pending schema migrations at startup.
+	Migrate bool `yaml:"migrate"`
+	// Seed creates the demo accounts admin/admin and user/user.
+	Seed bool `yaml:"seed"`
+}
+
+// Database is the PostgreSQL connection.
+type Database struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+
+	// Connection pool limits, see the matching methods of sql.DB. Zero
+	// means no limit.
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// ConnectTimeout bounds the connection attempts at startup.
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// HealthInterval is the period of the background database checks.
+	HealthInterval time.Duration `yaml:"health_interval"`
+}
+
+// DSN is the connection string for lib/pq.
+func (d Database) DSN() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     d.Host + ":" + strconv.Itoa(d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: url.Values{"sslmode": {d.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// Auth configures the tokens issued by /auth.
+type Auth struct {
+	// SigningKey is the PEM file of the RSA or Ed25519 private key signing
+	// the tokens. Without it, a key is generated at startup and the tokens
+	// are only valid until the process exits.
+	SigningKey string `yaml:"signing_key"`
+	// VerificationKeys are PEM files of further keys whose tokens are
+	// accepted, such as the previous signing key during a rotation.
+	VerificationKeys []string `yaml:"verification_keys"`
+	// TokenTTL is the lifetime of the access tokens. Role changes apply to a
+	// session once its access token expires and it is refreshed.
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	// RefreshTTL is the lifetime of the refresh tokens, which bounds how long
+	// a session lasts without activity.
+	RefreshTTL time.Duration `yaml:"refresh_ttl"`
+	// Issuer and Audience are the iss and aud claims of the tokens issued;
+	// tokens naming another issuer or audience are rejected.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// ClockSkew is how far the clocks of the issuer and of the verifier may
+	// drift apart when checking the exp, nbf and iat claims.
+	ClockSkew time.Duration `yaml:"clock_skew"`
+	// Registration is "open" to let anyone register at POST /users, or
+	// "invite" to require an invite created by an administrator.
+	Registration string `yaml:"registration"`
+	// InviteTTL is how long an invite can be used to register.
+	InviteTTL time.Duration `yaml:"invite_ttl"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:              8080,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			RequestTimeout:    10 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Storage: Storage{Backend: "postgres", SQLitePath: "filmotheka.db", Migrate: true},
+		Database: Database{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "filmotheka_user",
+			Name:    "filmotheka_db",
+			SSLMode: "disable",
+
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnectTimeout:  30 * time.Second,
+			HealthInterval:  10 * time.Second,
+		},
+		Auth: Auth{
+			TokenTTL:   15 * time.Minute,
+			RefreshTTL: 30 * 24 * time.Hour,
+			Issuer:     "filmotheka",
+			Audience:   "filmotheka",
+			ClockSkew:  30 * time.Second,
+
+			Registration: "invite",
+			InviteTTL:    7 * 24 * time.Hour,
+		},
+		Log: Log{Level: "info"},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "filmotheka",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load registers the configuration flags on fs, parses args and layers the
+// defaults, the file named by -config or CONFIG_FILE, the environment and the
+// flags set in args. The result is validated.
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	path := fs.String("config", "", "path to a JSON or YAML configuration file")
+	flags := Default()
+	fs.IntVar(&flags.Server.Port, "port", flags.Server.Port, "port to listen on")
+	fs.StringVar(&flags.Storage.Backend, "storage", flags.Storage.Backend, `storage backend: "postgres", "sqlite" or "memory"`)
+	fs.StringVar(&flags.Storage.SQLitePath, "sqlite-path", flags.Storage.SQLitePath, "SQLite database file")
+	fs.BoolVar(&flags.Storage.Migrate, "migrate", flags.Storage.Migrate, "apply pending schema migrations at startup")
+	fs.BoolVar(&flags.Storage.Seed, "seed", flags.Storage.Seed, "create the demo accounts admin/admin and user/user")
+	fs.StringVar(&flags.Log.Level, "log-level", flags.Log.Level, `log level: "debug", "info", "warn" or "error"`)
+	fs.StringVar(&flags.Tracing.Exporter, "tracing", flags.Tracing.Exporter, `trace exporter: "none", "stdout" or "otlp"`)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *path == "" {
+		*path = os.Getenv("CONFIG_FILE")
+	}
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return Config{}, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = flags.Server.Port
+		case "storage":
+			cfg.Storage.Backend = flags.Storage.Backend
+		case "sqlite-path":
+			cfg.Storage.SQLitePath = flags.Storage.SQLitePath
+		case "migrate":
+			cfg.Storage.Migrate = flags.Storage.Migrate
+		case "seed":
+			cfg.Storage.Seed = flags.Storage.Seed
+		case "log-level":
+			cfg.Log.Level = flags.Log.Level
+		case "tracing":
+			cfg.Tracing.Exporter = flags.Tracing.Exporter
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
+
+// loadFile overrides the settings present in the file at path. JSON is read
+// as YAML, of which it is a subset.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides the settings whose environment variable is set.
+func (c *Config) loadEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	num := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", name, v))
+			}
+			*dst = n
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", name, v))
+			}
+			*dst = b
+		}
+	}
+	float := func(name string, dst *float64) {
+		if v, ok := os.LookupEnv(name); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", name, v))
+			}
+			*dst = f
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration", name, v))
+			}
+			*dst = d
+		}
+	}
+
+	num("SERVER_PORT", &c.Server.Port)
+	duration("SERVER_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	duration("SERVER_READ_TIMEOUT", &c.Server.ReadTimeout)
+	duration("SERVER_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	duration("SERVER_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	num("SERVER_MAX_HEADER_BYTES", &c.Server.MaxHeaderBytes)
+	duration("SERVER_REQUEST_TIMEOUT", &c.Server.RequestTimeout)
+	duration("SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	str("STORAGE_BACKEND", &c.Storage.Backend)
+	str("SQLITE_PATH", &c.Storage.SQLitePath)
+	boolean("MIGRATE", &c.Storage.Migrate)
+	boolean("SEED", &c.Storage.Seed)
+	str("DB_HOST", &c.Database.Host)
+	num("DB_PORT", &c.Database.Port)
+	str("DB_USER", &c.Database.User)
+	str("DB_PASSWORD", &c.Database.Password)
+	str("DB_NAME", &c.Database.Name)
+	str("DB_SSLMODE", &c.Database.SSLMode)
+	num("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	num("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	duration("DB_CONNECT_TIMEOUT", &c.Database.ConnectTimeout)
+	duration("DB_HEALTH_INTERVAL", &c.Database.HealthInterval)
+	str("JWT_SIGNING_KEY", &c.Auth.SigningKey)
+	list("JWT_VERIFICATION_KEYS", &c.Auth.VerificationKeys)
+	duration("TOKEN_TTL", &c.Auth.TokenTTL)
+	duration("REFRESH_TOKEN_TTL", &c.Auth.RefreshTTL)
+	str("JWT_ISSUER", &c.Auth.Issuer)
+	str("JWT_AUDIENCE", &c.Auth.Audience)
+	duration("JWT_CLOCK_SKEW", &c.Auth.ClockSkew)
+	str("REGISTRATION", &c.Auth.Registration)
+	duration("INVITE_TTL", &c.Auth.InviteTTL)
+	str("LOG_LEVEL", &c.Log.Level)
+	str("TRACING_EXPORTER", &c.Tracing.Exporter)
+	str("TRACING_ENDPOINT", &c.Tracing.Endpoint)
+	str("TRACING_SERVICE_NAME", &c.Tracing.ServiceName)
+	float("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting that cannot be used.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server port %d is out of range", c.Server.Port))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 || c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 ||
+		c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server timeouts must be positive"))
+	}
+	if c.Server.RequestTimeout <= 0 || c.Server.RequestTimeout >= c.Server.WriteTimeout {
+		errs = append(errs, errors.New("server request timeout must be positive and shorter than the write timeout"))
+	}
+	if c.Server.MaxHeaderBytes < 4<<10 {
+		errs = append(errs, errors.New("server max header bytes must be at least 4096"))
+	}
+	switch c.Storage.Backend {
+	case "postgres":
+		if c.Database.Host == "" || c.Database.User == "" || c.Database.Name == "" {
+			errs = append(errs, errors.New("database host, user and name are required"))
+		}
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database port %d is out of range", c.Database.Port))
+		}
+		if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+			errs = append(errs, errors.New("database pool limits cannot be negative"))
+		}
+		if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+			errs = append(errs, errors.New("database idle connections cannot exceed the open connections"))
+		}
+		if c.Database.ConnectTimeout <= 0 {
+			errs = append(errs, errors.New("database connect timeout must be positive"))
+		}
+	case "sqlite":
+		if c.Storage.SQLitePath == "" {
+			errs = append(errs, errors.New("SQLite path is required"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage backend %q", c.Storage.Backend))
+	}
+	if c.Database.HealthInterval <= 0 {
+		errs = append(errs, errors.New("database health interval must be positive"))
+	}
+	if c.Auth.SigningKey == "" && len(c.Auth.VerificationKeys) > 0 {
+		errs = append(errs, errors.New("JWT verification keys require a signing key"))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("unknown log level %q", c.Log.Level))
+	}
+	if c.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("token TTL must be positive"))
+	}
+	if c.Auth.RefreshTTL <= c.Auth.TokenTTL {
+		errs = append(errs, errors.New("refresh token TTL must be longer than the token TTL"))
+	}
+	if c.Auth.Issuer == "" || c.Auth.Audience == "" {
+		errs = append(errs, errors.New("JWT issuer and audience are required"))
+	}
+	if c.Auth.ClockSkew < 0 || c.Auth.ClockSkew >= c.Auth.TokenTTL {
+		errs = append(errs, errors.New("JWT clock skew must be between 0 and the token TTL"))
+	}
+	if c.Auth.Registration != "open" && c.Auth.Registration != "invite" {
+		errs = append(errs, fmt.Errorf("unknown registration mode %q", c.Auth.Registration))
+	}
+	if c.Auth.InviteTTL <= 0 {
+		errs = append(errs, errors.New("invite TTL must be positive"))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("tracing endpoint %q is not an http or https URL", c.Tracing.Endpoint))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown trace exporter %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing sample ratio must be between 0 and 1"))
+	}
+	return errors.Join(errs...)
+}
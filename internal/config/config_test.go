@@ -0,0 +1,129 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func load(t *testing.T, args ...string) (config.Config, error) {
+	return config.Load(flag.NewFlagSet("filmotheka", flag.ContinueOnError), args)
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(t)
+	require.NoError(t, err)
+	assert.Equal(t, config.Default(), cfg)
+	assert.Equal(t, ":8080", cfg.Server.Addr())
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filmotheka.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  port: 9000
+storage:
+  backend: sqlite
+  sqlite_path: /data/file.db
+database:
+  host: file-host
+auth:
+  signing_key: /keys/signing.pem
+  token_ttl: 1h
+`), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("SERVER_PORT", "9001")
+	t.Setenv("JWT_VERIFICATION_KEYS", "/keys/old.pem, /keys/older.pem")
+
+	cfg, err := load(t, "-port", "9002", "-seed")
+	require.NoError(t, err)
+	assert.Equal(t, 9002, cfg.Server.Port, "flags override the environment")
+	assert.Equal(t, "env-host", cfg.Database.Host, "the environment overrides the file")
+	assert.Equal(t, "sqlite", cfg.Storage.Backend)
+	assert.Equal(t, "/data/file.db", cfg.Storage.SQLitePath)
+	assert.Equal(t, time.Hour, cfg.Auth.TokenTTL)
+	assert.Equal(t, "/keys/signing.pem", cfg.Auth.SigningKey)
+	assert.Equal(t, []string{"/keys/old.pem", "/keys/older.pem"}, cfg.Auth.VerificationKeys)
+	assert.True(t, cfg.Storage.Seed)
+	assert.True(t, cfg.Storage.Migrate, "defaults fill in what no layer sets")
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filmotheka.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"storage": {"backend": "memory"}}`), 0o600))
+
+	cfg, err := load(t, "-config", path)
+	require.NoError(t, err)
+	assert.Equal(t, "memory", cfg.Storage.Backend)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"storage": {"engine": "memory"}}`), 0o600))
+	_, err = load(t, "-config", path)
+	assert.Error(t, err, "unknown keys are rejected")
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	t.Setenv("JWT_VERIFICATION_KEYS", "/keys/old.pem")
+	t.Setenv("SERVER_PORT", "eighty")
+	_, err := load(t)
+	assert.ErrorContains(t, err, "SERVER_PORT")
+
+	t.Setenv("SERVER_PORT", "70000")
+	t.Setenv("STORAGE_BACKEND", "mysql")
+	_, err = load(t)
+	assert.ErrorContains(t, err, "server port 70000 is out of range")
+	assert.ErrorContains(t, err, `unknown storage backend "mysql"`)
+	assert.ErrorContains(t, err, "JWT verification keys require a signing key")
+
+	t.Setenv("SERVER_PORT", "8080")
+	t.Setenv("STORAGE_BACKEND", "postgres")
+	t.Setenv("JWT_SIGNING_KEY", "/keys/signing.pem")
+	t.Setenv("DB_MAX_OPEN_CONNS", "4")
+	t.Setenv("DB_MAX_IDLE_CONNS", "8")
+	t.Setenv("DB_CONNECT_TIMEOUT", "0s")
+	_, err = load(t)
+	assert.ErrorContains(t, err, "idle connections cannot exceed the open connections")
+	assert.ErrorContains(t, err, "connect timeout must be positive")
+
+	t.Setenv("SERVER_REQUEST_TIMEOUT", "1m")
+	_, err = load(t)
+	assert.ErrorContains(t, err, "request timeout must be positive and shorter than the write timeout")
+
+	t.Setenv("SERVER_REQUEST_TIMEOUT", "10s")
+	t.Setenv("DB_MAX_IDLE_CONNS", "4")
+	t.Setenv("DB_CONNECT_TIMEOUT", "1s")
+	t.Setenv("TRACING_SAMPLE_RATIO", "2")
+	_, err = load(t, "-tracing", "otlp")
+	assert.ErrorContains(t, err, "sample ratio must be between 0 and 1")
+	assert.NotContains(t, err.Error(), "tracing endpoint", "the default endpoint is valid")
+
+	t.Setenv("TRACING_ENDPOINT", "localhost:4318")
+	_, err = load(t, "-tracing", "otlp")
+	assert.ErrorContains(t, err, `tracing endpoint "localhost:4318" is not an http or https URL`)
+
+	_, err = load(t, "-tracing", "jaeger")
+	assert.ErrorContains(t, err, `unknown trace exporter "jaeger"`)
+
+	t.Setenv("REFRESH_TOKEN_TTL", "10m")
+	_, err = load(t)
+	assert.ErrorContains(t, err, "refresh token TTL must be longer than the token TTL")
+
+	t.Setenv("JWT_AUDIENCE", "")
+	t.Setenv("JWT_CLOCK_SKEW", "20m")
+	t.Setenv("REGISTRATION", "closed")
+	_, err = load(t)
+	assert.ErrorContains(t, err, `unknown registration mode "closed"`)
+	assert.ErrorContains(t, err, "JWT issuer and audience are required")
+	assert.ErrorContains(t, err, "JWT clock skew must be between 0 and the token TTL")
+}
+
+func TestDatabaseDSN(t *testing.T) {
+	db := config.Database{Host: "db", Port: 5432, User: "film", Password: "p@ss word", Name: "films", SSLMode: "disable"}
+	assert.Equal(t, "postgres://film:p%40ss%20word@db:5432/films?sslmode=disable", db.DSN())
+}
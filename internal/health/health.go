@@ -0,0 +1,72 @@
+// Package health serves the liveness, readiness and build information
+// endpoints probed by docker-compose and orchestrators.
+package health
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/axywe/filmotheka_vk/internal/version"
+	"github.com/axywe/filmotheka_vk/util"
+)
+
+// Check reports why a dependency is not ready, or nil when it is.
+type Check func(ctx context.Context) error
+
+// Status is the body of the liveness and readiness responses. Checks maps
+// each readiness check to "ok" or the reason it failed.
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type Handler struct {
+	checks map[string]Check
+}
+
+// NewHandler returns a handler whose readiness depends on checks, keyed by
+// the name of the checked dependency.
+func NewHandler(checks map[string]Check) *Handler {
+	return &Handler{checks: checks}
+}
+
+// @Summary Liveness probe
+// @Description Answers as long as the process serves HTTP.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} Status "Process alive"
+// @Router /healthz [get]
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	util.SendJSONResponse(w, r, Status{Status: "ok"}, http.StatusOK)
+}
+
+// @Summary Readiness probe
+// @Description Reports whether the database is reachable and every schema migration is applied.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} Status "Ready to serve requests"
+// @Failure 503 {object} Status "A dependency is not ready"
+// @Router /readyz [get]
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	status := Status{Status: "ok", Checks: make(map[string]string, len(h.checks))}
+	code := http.StatusOK
+	for name, check := range h.checks {
+		if err := check(r.Context()); err != nil {
+			status.Status = "unavailable"
+			status.Checks[name] = err.Error()
+			code = http.StatusServiceUnavailable
+		} else {
+			status.Checks[name] = "ok"
+		}
+	}
+	util.SendJSONResponse(w, r, status, code)
+}
+
+// @Summary Build information
+// @Tags Health
+// @Produce json
+// @Success 200 {object} version.Info "Commit, build time and Go version"
+// @Router /version [get]
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+	util.SendJSONResponse(w, r, version.Get(), http.StatusOK)
+}
@@ -0,0 +1,57 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/internal/health"
+	"github.com/axywe/filmotheka_vk/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, handler http.HandlerFunc, path string, body interface{}) int {
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(body))
+	return rr.Code
+}
+
+func TestLiveAndReady(t *testing.T) {
+	var dbErr error
+	h := health.NewHandler(map[string]health.Check{
+		"database": func(context.Context) error { return dbErr },
+	})
+
+	var status health.Status
+	assert.Equal(t, http.StatusOK, get(t, h.Live, "/healthz", &status))
+	assert.Equal(t, "ok", status.Status)
+
+	status = health.Status{}
+	assert.Equal(t, http.StatusOK, get(t, h.Ready, "/readyz", &status))
+	assert.Equal(t, health.Status{Status: "ok", Checks: map[string]string{"database": "ok"}}, status)
+
+	dbErr = errors.New("connection refused")
+	status = health.Status{}
+	assert.Equal(t, http.StatusServiceUnavailable, get(t, h.Ready, "/readyz", &status))
+	assert.Equal(t, health.Status{Status: "unavailable", Checks: map[string]string{"database": "connection refused"}}, status)
+
+	status = health.Status{}
+	assert.Equal(t, http.StatusOK, get(t, h.Live, "/healthz", &status), "liveness ignores the dependencies")
+}
+
+func TestVersion(t *testing.T) {
+	version.Commit = "abc123"
+	defer func() { version.Commit = "" }()
+
+	var info version.Info
+	assert.Equal(t, http.StatusOK, get(t, health.NewHandler(nil).Version, "/version", &info))
+	assert.Equal(t, "abc123", info.Commit)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.NotEmpty(t, info.BuildTime)
+}
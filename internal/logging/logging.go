@@ -0,0 +1,129 @@
+// Package logging writes structured JSON logs and carries a request-scoped
+// logger in the request context.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// RequestIDHeader carries the ID that correlates the log lines of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID accepts the request IDs propagated from clients and proxies.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	userKey
+)
+
+// New returns a logger writing JSON lines to w at level and above.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// FromContext returns the logger of the request ctx belongs to, or the
+// default logger outside of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// user is filled in by the authentication middleware, which runs inside the
+// access log middleware, and read back when the request is logged.
+type user struct {
+	id   int
+	role int
+	set  bool
+}
+
+// SetUser records the authenticated user of the request ctx belongs to, so
+// that the access log line names them.
+func SetUser(ctx context.Context, id, role int) {
+	if u, ok := ctx.Value(userKey).(*user); ok {
+		*u = user{id: id, role: role, set: true}
+	}
+}
+
+// Middleware logs one line per request with logger. It propagates the
+// X-Request-ID of the request, or generates one, echoes it in the response
+// and hands the handlers a logger carrying it.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		reqLogger := logger.With("request_id", id)
+		u := &user{}
+		ctx := context.WithValue(r.Context(), loggerKey, reqLogger)
+		ctx = context.WithValue(ctx, userKey, u)
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr", r.RemoteAddr,
+		}
+		if u.set {
+			attrs = append(attrs, "user_id", u.id, "role", u.role)
+		}
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		reqLogger.Log(ctx, level, "request", attrs...)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recorder captures the status code and size of a response.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,85 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lines decodes the JSON lines written to buf.
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var out []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]interface{}
+		require.NoError(t, dec.Decode(&line))
+		out = append(out, line)
+	}
+	return out
+}
+
+func TestMiddlewareLogsRequests(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelDebug)
+	h := logging.Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUser(r.Context(), 7, 1)
+		logging.FromContext(r.Context()).Debug("sql", "statement", "SELECT 1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/movies?title=x", nil)
+	req.Header.Set(logging.RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, "abc-123", rr.Header().Get(logging.RequestIDHeader))
+
+	logged := lines(t, &buf)
+	require.Len(t, logged, 2)
+	assert.Equal(t, "sql", logged[0]["msg"])
+	assert.Equal(t, "abc-123", logged[0]["request_id"], "handlers log with the request ID")
+
+	access := logged[1]
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "INFO", access["level"])
+	assert.Equal(t, "abc-123", access["request_id"])
+	assert.Equal(t, "POST", access["method"])
+	assert.Equal(t, "/movies", access["path"])
+	assert.Equal(t, 201.0, access["status"])
+	assert.Equal(t, 5.0, access["bytes"])
+	assert.Equal(t, 7.0, access["user_id"])
+	assert.Equal(t, 1.0, access["role"])
+	assert.Contains(t, access, "latency_ms")
+}
+
+func TestMiddlewareGeneratesRequestIDs(t *testing.T) {
+	var buf bytes.Buffer
+	h := logging.Middleware(logging.New(&buf, slog.LevelInfo), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Debug("hidden below the level")
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/actors", nil)
+	req.Header.Set(logging.RequestIDHeader, "not a valid id\n")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	id := rr.Header().Get(logging.RequestIDHeader)
+	assert.Len(t, id, 32)
+	logged := lines(t, &buf)
+	require.Len(t, logged, 1)
+	assert.Equal(t, id, logged[0]["request_id"])
+	assert.Equal(t, "ERROR", logged[0]["level"])
+	assert.NotContains(t, logged[0], "user_id", "anonymous requests carry no user")
+}
+
+func TestFromContextOutsideRequests(t *testing.T) {
+	assert.Same(t, slog.Default(), logging.FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()))
+}
@@ -0,0 +1,130 @@
+// Package metrics collects the application metrics and serves them in the
+// Prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every collector of the application, apart from the global
+// default registry of the Prometheus client.
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filmotheka_http_requests_total",
+		Help: "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "filmotheka_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filmotheka_auth_total",
+		Help: "Logins, token refreshes and token checks of protected routes, by outcome and reason.",
+	}, []string{"stage", "result", "reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		requests,
+		latency,
+		authentications,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics of Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exposes the connection pool statistics of db.
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Instrument counts and times the requests served by next under the route
+// label, which should be the pattern next is registered with so that the
+// number of series stays bounded.
+func Instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		status := strconv.Itoa(rec.status)
+		method := methodLabel(r.Method)
+		requests.WithLabelValues(route, method, status).Inc()
+		latency.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel returns method if it is a standard HTTP method and "other"
+// otherwise: routes registered without a method accept any method a client
+// makes up, which would add series without bound.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// Stages of authentication.
+const (
+	// Login is the exchange of credentials for a token at /auth.
+	Login = "login"
+	// Refresh is the exchange of a refresh token for new tokens at
+	// /auth/refresh.
+	Refresh = "refresh"
+	// Token is the check of the bearer token of a protected request.
+	Token = "token"
+)
+
+// AuthSucceeded counts a successful authentication at stage.
+func AuthSucceeded(stage string) {
+	authentications.WithLabelValues(stage, "success", "ok").Inc()
+}
+
+// AuthFailed counts an authentication rejected at stage for reason.
+func AuthFailed(stage, reason string) {
+	authentications.WithLabelValues(stage, "failure", reason).Inc()
+}
+
+// statusRecorder captures the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
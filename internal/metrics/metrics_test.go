@@ -0,0 +1,68 @@
+package metrics_test
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// scrape fetches the metrics like Prometheus does.
+func scrape(t *testing.T) string {
+	srv := httptest.NewServer(metrics.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestScrape(t *testing.T) {
+	h := metrics.Instrument("/movies/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("/movies/{id}", h)
+	for _, path := range []string{"/movies/1", "/movies/2", "/movies/0"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	for _, method := range []string{"BREW", "WHEN"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/movies/1", nil))
+	}
+
+	metrics.AuthSucceeded(metrics.Login)
+	metrics.AuthFailed(metrics.Token, "invalid_token")
+	metrics.AuthFailed(metrics.Token, "invalid_token")
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	metrics.RegisterDB(db, "sqlite")
+
+	body := scrape(t)
+	assert.Contains(t, body, `filmotheka_http_requests_total{method="GET",route="/movies/{id}",status="200"} 2`)
+	assert.Contains(t, body, `filmotheka_http_requests_total{method="GET",route="/movies/{id}",status="404"} 1`)
+	assert.Contains(t, body, `filmotheka_http_request_duration_seconds_count{method="GET",route="/movies/{id}",status="200"} 2`)
+	assert.Contains(t, body, `filmotheka_http_requests_total{method="other",route="/movies/{id}",status="200"} 2`)
+	assert.NotContains(t, body, `method="BREW"`)
+	assert.Contains(t, body, `filmotheka_auth_total{reason="ok",result="success",stage="login"} 1`)
+	assert.Contains(t, body, `filmotheka_auth_total{reason="invalid_token",result="failure",stage="token"} 2`)
+	assert.Contains(t, body, `go_sql_open_connections{db_name="sqlite"} 0`)
+	assert.Contains(t, body, "go_goroutines")
+}
@@ -1,43 +1,117 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/logging"
+	"github.com/axywe/filmotheka_vk/internal/metrics"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
 	"github.com/axywe/filmotheka_vk/util"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-func RoleCheckMiddleware(next http.Handler) http.Handler {
+// Authenticate lets through requests bearing a valid token verified by
+// authority that is not on denylist, whatever their role. The claims of the
+// token are stored in the request context, see tokens.FromContext.
+func Authenticate(authority *tokens.Authority, denylist auth.Denylist, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		const BearerSchema = "Bearer "
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		claims, ok := authenticate(w, r, authority, denylist)
+		if !ok {
 			return
 		}
-		tokenString := strings.TrimPrefix(authHeader, BearerSchema)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte("your_secret_key"), nil
-		})
+		metrics.AuthSucceeded(metrics.Token)
+		next.ServeHTTP(w, r.WithContext(tokens.NewContext(r.Context(), claims)))
+	})
+}
+
+// Authorizer tells whether a token was revoked and what its role may do.
+type Authorizer interface {
+	auth.Denylist
+	auth.RoleStore
+}
 
-		if err != nil {
-			util.SendJSONError(w, r, "Invalid token", http.StatusUnauthorized)
+// RequirePermission lets through requests bearing a valid token verified by
+// authority that is not revoked and whose role grants permission. The role is
+// looked up on every request, so that changes to it apply at once.
+func RequirePermission(authority *tokens.Authority, store Authorizer, permission auth.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := authenticate(w, r, authority, store)
+		if !ok {
+			return
+		}
+		role, err := store.GetRole(r.Context(), claims.Role)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			metrics.AuthFailed(metrics.Token, "store_error")
+			util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
 			return
 		}
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			if role, ok := claims["role"].(float64); ok {
-				if role == 1 {
-					next.ServeHTTP(w, r)
-				} else if role == 2 && r.Method == http.MethodGet {
-					next.ServeHTTP(w, r)
-				} else {
-					util.SendJSONError(w, r, "Not authorized for this action", http.StatusForbidden)
-				}
-			} else {
-				util.SendJSONError(w, r, "Invalid token claims: role missing or invalid", http.StatusUnauthorized)
-			}
+		// A deleted role grants nothing.
+		if !role.Can(permission) {
+			metrics.AuthFailed(metrics.Token, "forbidden")
+			util.SendJSONError(w, r, "Not authorized for this action", http.StatusForbidden)
+			return
 		}
+		metrics.AuthSucceeded(metrics.Token)
+		next.ServeHTTP(w, r.WithContext(tokens.NewContext(r.Context(), claims)))
+	})
+}
+
+// authenticate verifies the bearer token of r. If the token is missing,
+// invalid or revoked, it answers the request and returns false.
+func authenticate(w http.ResponseWriter, r *http.Request, authority *tokens.Authority, denylist auth.Denylist) (*tokens.Claims, bool) {
+	const BearerSchema = "Bearer "
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		metrics.AuthFailed(metrics.Token, "missing_token")
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return nil, false
+	}
+	tokenString := strings.TrimPrefix(authHeader, BearerSchema)
+	claims, err := authority.ParseToken(tokenString)
+
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		metrics.AuthFailed(metrics.Token, "expired_token")
+		util.SendJSONError(w, r, "Token expired", http.StatusUnauthorized)
+		return nil, false
+	case errors.Is(err, jwt.ErrTokenInvalidClaims):
+		metrics.AuthFailed(metrics.Token, "invalid_claims")
+		util.SendJSONError(w, r, "Invalid token claims", http.StatusUnauthorized)
+		return nil, false
+	case err != nil:
+		metrics.AuthFailed(metrics.Token, "invalid_token")
+		util.SendJSONError(w, r, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+	logging.SetUser(r.Context(), claims.UserID(), claims.Role)
 
+	revoked, err := denylist.AccessTokenRevoked(r.Context(), claims.ID)
+	if err != nil {
+		metrics.AuthFailed(metrics.Token, "store_error")
+		util.SendJSONError(w, r, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if revoked {
+		metrics.AuthFailed(metrics.Token, "revoked_token")
+		util.SendJSONError(w, r, "Token revoked", http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
+
+// Deadline bounds the context of every request to timeout, so that the
+// database work done for a request is abandoned once its time is up or its
+// client has gone.
+func Deadline(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
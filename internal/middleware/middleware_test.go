@@ -2,43 +2,106 @@ package middleware_test
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/config"
 	"github.com/axywe/filmotheka_vk/internal/middleware"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
-func generateToken(role float64, secretKey string) string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"role": role,
-	})
-	tokenString, _ := token.SignedString([]byte(secretKey))
-	return tokenString
+var testAuth = config.Auth{TokenTTL: time.Hour, Issuer: "filmotheka", Audience: "filmotheka", ClockSkew: time.Minute}
+
+// testKeys signs the tokens of the tests with a generated Ed25519 key.
+var testKeys = func() *tokens.Keyring {
+	keys, err := tokens.LoadKeyring(testAuth)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}()
+
+var testAuthority = tokens.NewAuthority(testKeys, testAuth)
+
+// denylist holds the revoked jti claims.
+type denylist map[string]bool
+
+func (d denylist) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return d[jti], nil
+}
+
+// roles holds the roles by ID.
+type roles map[int]auth.Role
+
+func (r roles) GetRole(ctx context.Context, id int) (auth.Role, error) {
+	role, ok := r[id]
+	if !ok {
+		return auth.Role{}, storage.ErrNotFound
+	}
+	return role, nil
+}
+
+type authorizer struct {
+	denylist
+	roles
+}
+
+// testRoles grants every permission to role 1 and movies:read to role 2.
+var testRoles = roles{
+	1: {ID: 1, Name: "admin", Permissions: auth.Permissions},
+	2: {ID: 2, Name: "viewer", Permissions: []auth.Permission{auth.MoviesRead}},
+}
+
+// testClaims returns valid claims of a token of user 7 with role.
+func testClaims(role int) *tokens.Claims {
+	now := time.Now()
+	return &tokens.Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "7",
+			Issuer:    "filmotheka",
+			Audience:  jwt.ClaimStrings{"filmotheka"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			ID:        "0123456789abcdef0123456789abcdef",
+		},
+	}
 }
 
-func TestRoleCheckMiddleware(t *testing.T) {
-	secretKey := "your_secret_key" 
+func generateToken(role int) string {
+	tokenString, _ := testKeys.Sign(testClaims(role))
+	return tokenString
+}
 
+func TestRequirePermission(t *testing.T) {
 	tests := []struct {
 		name           string
-		tokenRole      float64
-		requestMethod  string
+		tokenRole      int
+		permission     auth.Permission
 		expectedStatus int
 	}{
-		{"ValidTokenRole1", 1, http.MethodGet, http.StatusOK},
-		{"ValidTokenRole2Get", 2, http.MethodGet, http.StatusOK},
-		{"ValidTokenRole2Post", 2, http.MethodPost, http.StatusForbidden},
-		{"NoToken", 0, http.MethodGet, http.StatusUnauthorized},
+		{"AdminRead", 1, auth.MoviesRead, http.StatusOK},
+		{"AdminWrite", 1, auth.MoviesWrite, http.StatusOK},
+		{"ViewerRead", 2, auth.MoviesRead, http.StatusOK},
+		{"ViewerWrite", 2, auth.MoviesWrite, http.StatusForbidden},
+		{"ViewerOtherResource", 2, auth.ActorsRead, http.StatusForbidden},
+		{"UnknownRole", 9, auth.MoviesRead, http.StatusForbidden},
+		{"NoToken", 0, auth.MoviesRead, http.StatusUnauthorized},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			req, _ := http.NewRequest(test.requestMethod, "/", bytes.NewBufferString(""))
+			req, _ := http.NewRequest(http.MethodGet, "/", bytes.NewBufferString(""))
 			if test.name != "NoToken" {
-				token := generateToken(test.tokenRole, secretKey)
+				token := generateToken(test.tokenRole)
 				req.Header.Set("Authorization", "Bearer "+token)
 			}
 
@@ -47,14 +110,14 @@ func TestRoleCheckMiddleware(t *testing.T) {
 				w.WriteHeader(http.StatusOK)
 			})
 
-			middleware.RoleCheckMiddleware(handler).ServeHTTP(rr, req)
+			middleware.RequirePermission(testAuthority, authorizer{denylist{}, testRoles}, test.permission, handler).ServeHTTP(rr, req)
 
 			assert.Equal(t, test.expectedStatus, rr.Code)
 		})
 	}
 }
 
-func TestRoleCheckMiddlewareWithError(t *testing.T) {
+func TestRequirePermissionWithError(t *testing.T) {
 	tests := []struct {
 		name           string
 		token          string
@@ -72,21 +135,18 @@ func TestRoleCheckMiddlewareWithError(t *testing.T) {
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
-			middleware.RoleCheckMiddleware(handler).ServeHTTP(rr, req)
+			middleware.RequirePermission(testAuthority, authorizer{denylist{}, testRoles}, auth.MoviesRead, handler).ServeHTTP(rr, req)
 
 			assert.Equal(t, test.expectedStatus, rr.Code)
 		})
 	}
 }
 
-func TestRoleCheckMiddlewareWithInvalidClaims(t *testing.T) {
-	secretKey := "your_secret_key"
-
+func TestRequirePermissionWithInvalidClaims(t *testing.T) {
 	generateInvalidClaimsToken := func() string {
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		tokenString, _ := testKeys.Sign(jwt.MapClaims{
 			"not_role": "should_fail",
 		})
-		tokenString, _ := token.SignedString([]byte(secretKey))
 		return tokenString
 	}
 
@@ -97,7 +157,108 @@ func TestRoleCheckMiddlewareWithInvalidClaims(t *testing.T) {
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
-	middleware.RoleCheckMiddleware(handler).ServeHTTP(rr, req)
+	middleware.RequirePermission(testAuthority, authorizer{denylist{}, testRoles}, auth.MoviesRead, handler).ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
+
+func TestRequirePermissionWithRevokedToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+generateToken(1))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	revoked := denylist{"0123456789abcdef0123456789abcdef": true}
+	middleware.RequirePermission(testAuthority, authorizer{revoked, testRoles}, auth.MoviesRead, handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestRequirePermissionValidatesClaims(t *testing.T) {
+	ago := func(d time.Duration) *jwt.NumericDate { return jwt.NewNumericDate(time.Now().Add(-d)) }
+	tests := []struct {
+		name           string
+		modify         func(c *tokens.Claims)
+		expectedStatus int
+	}{
+		{"Valid", func(c *tokens.Claims) {}, http.StatusOK},
+		{"NoJTI", func(c *tokens.Claims) { c.ID = "" }, http.StatusUnauthorized},
+		{"NoSubject", func(c *tokens.Claims) { c.Subject = "" }, http.StatusUnauthorized},
+		{"NoRole", func(c *tokens.Claims) { c.Role = 0 }, http.StatusUnauthorized},
+		{"NoExpiry", func(c *tokens.Claims) { c.ExpiresAt = nil }, http.StatusUnauthorized},
+		{"OtherIssuer", func(c *tokens.Claims) { c.Issuer = "elsewhere" }, http.StatusUnauthorized},
+		{"OtherAudience", func(c *tokens.Claims) { c.Audience = jwt.ClaimStrings{"elsewhere"} }, http.StatusUnauthorized},
+		{"Expired", func(c *tokens.Claims) { c.ExpiresAt = ago(2 * time.Minute) }, http.StatusUnauthorized},
+		{"ExpiredWithinSkew", func(c *tokens.Claims) { c.ExpiresAt = ago(30 * time.Second) }, http.StatusOK},
+		{"NotYetValid", func(c *tokens.Claims) { c.NotBefore = ago(-2 * time.Minute) }, http.StatusUnauthorized},
+		{"NotYetValidWithinSkew", func(c *tokens.Claims) { c.NotBefore = ago(-30 * time.Second) }, http.StatusOK},
+		{"IssuedInTheFuture", func(c *tokens.Claims) { c.IssuedAt = ago(-2 * time.Minute) }, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := testClaims(1)
+			test.modify(claims)
+			tokenString, err := testKeys.Sign(claims)
+			assert.NoError(t, err)
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			middleware.RequirePermission(testAuthority, authorizer{denylist{}, testRoles}, auth.MoviesRead, handler).ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestAuthenticateIgnoresRole(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+generateToken(2))
+
+	rr := httptest.NewRecorder()
+	var claims *tokens.Claims
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = tokens.FromContext(r.Context())
+	})
+
+	middleware.Authenticate(testAuthority, denylist{}, handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, claims.Role)
+	assert.Equal(t, 7, claims.UserID())
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", claims.ID)
+}
+
+func TestRequirePermissionRejectsOtherKeys(t *testing.T) {
+	otherKeys, err := tokens.LoadKeyring(config.Auth{})
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	claims := testClaims(1)
+	unknownKey, _ := otherKeys.Sign(claims)
+	// A token MACed with the public key, naming a key of the keyring.
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmac.Header["kid"] = testKeys.JWKS().Keys[0].ID
+	hmacToken, _ := hmac.SignedString([]byte(testKeys.JWKS().Keys[0].X))
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	none.Header["kid"] = testKeys.JWKS().Keys[0].ID
+	noneToken, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	for name, token := range map[string]string{"UnknownKey": unknownKey, "HS256": hmacToken, "None": noneToken} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			middleware.RequirePermission(testAuthority, authorizer{denylist{}, testRoles}, auth.MoviesRead, handler).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted, as required for RS256 by
+// RFC 7518.
+const minRSABits = 2048
+
+// key is a key of a Keyring. signer is only set for the signing key.
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	signer crypto.Signer
+}
+
+// Keyring holds the private key signing new tokens and the public keys tokens
+// are verified with: the signing key and, during a rotation, the keys that
+// signed tokens still in use. Keys are RSA, for RS256, or Ed25519, for EdDSA,
+// and are identified in the kid header of the tokens by their RFC 7638
+// thumbprint.
+type Keyring struct {
+	signing *key
+	keys    map[string]*key
+}
+
+// LoadKeyring reads the keys named by cfg from PEM files. Without a signing
+// key, it generates an Ed25519 key, so the tokens it signs are only valid
+// until the process exits.
+func LoadKeyring(cfg config.Auth) (*Keyring, error) {
+	var signer crypto.Signer
+	if cfg.SigningKey == "" {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer = priv
+	} else {
+		k, err := readPEM(cfg.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if signer, ok = k.(crypto.Signer); !ok {
+			return nil, fmt.Errorf("signing key %s: not a private key", cfg.SigningKey)
+		}
+	}
+
+	verification := make([]crypto.PublicKey, 0, len(cfg.VerificationKeys))
+	for _, path := range cfg.VerificationKeys {
+		k, err := readPEM(path)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := k.(crypto.Signer); ok {
+			k = signer.Public()
+		}
+		verification = append(verification, k)
+	}
+	return NewKeyring(signer, verification...)
+}
+
+// NewKeyring returns a keyring signing with signer and verifying with its
+// public key and the verification keys.
+func NewKeyring(signer crypto.Signer, verification ...crypto.PublicKey) (*Keyring, error) {
+	signing, err := newKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	signing.signer = signer
+	k := &Keyring{signing: signing, keys: map[string]*key{signing.id: signing}}
+	for _, public := range verification {
+		v, err := newKey(public)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.keys[v.id]; !ok {
+			k.keys[v.id] = v
+		}
+	}
+	return k, nil
+}
+
+func newKey(public crypto.PublicKey) (*key, error) {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+		}
+		return &key{id: thumbprint(jwkOf(public)), method: jwt.SigningMethodRS256, public: public}, nil
+	case ed25519.PublicKey:
+		return &key{id: thumbprint(jwkOf(public)), method: jwt.SigningMethodEdDSA, public: public}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", public)
+	}
+}
+
+// readPEM parses the first PEM block of the file at path: a PKCS #8 or
+// PKCS #1 private key, or a PKIX or PKCS #1 public key.
+func readPEM(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	var k interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		k, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		k, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		k, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		k, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// Sign returns the token carrying claims, signed with the signing key.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+	return token.SignedString(k.signing.signer)
+}
+
+// Parse verifies tokenString and decodes its claims into claims, validating
+// them with opts. The token must name one of the keys in its kid header and be
+// signed with the algorithm of that key, whatever its alg header claims.
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+		}
+		return key.public, nil
+	}, opts...)
+	return err
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	KeyType string `json:"kty"`
+	ID      string `json:"kid,omitempty"`
+	Use     string `json:"use,omitempty"`
+	Alg     string `json:"alg,omitempty"`
+	// RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func jwkOf(public crypto.PublicKey) JWK {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{KeyType: "RSA", N: enc(public.N.Bytes()), E: enc(big.NewInt(int64(public.E)).Bytes())}
+	case ed25519.PublicKey:
+		return JWK{KeyType: "OKP", Curve: "Ed25519", X: enc(public)}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 thumbprint of jwk: the hash of its
+// required members in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members string
+	switch jwk.KeyType {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Curve, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS returns the public keys of the keyring, ordered by ID.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := jwkOf(key.public)
+		jwk.ID = key.id
+		jwk.Use = "sig"
+		jwk.Alg = key.method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].ID < set.Keys[j].ID })
+	return set
+}
+
+// @Summary JSON Web Key Set
+// @Description Lists the public keys the tokens are verified with, so that other services can verify them.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} JWKSet "Public keys"
+// @Router /.well-known/jwks.json [get]
+func (k *Keyring) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(k.JWKS())
+}
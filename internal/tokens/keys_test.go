@@ -0,0 +1,123 @@
+package tokens_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM stores a PEM block of typ holding der in a temporary file.
+func writePEM(t *testing.T, typ string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+	return path
+}
+
+func TestKeyringRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	rsaPath := writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	edPath := writePEM(t, "PRIVATE KEY", edDER)
+
+	old, err := tokens.LoadKeyring(config.Auth{SigningKey: rsaPath})
+	require.NoError(t, err)
+	claims := jwt.MapClaims{"role": 1, "exp": time.Now().Add(time.Hour).Unix()}
+	oldToken, err := old.Sign(claims)
+	require.NoError(t, err)
+
+	// The Ed25519 key takes over; the RSA key only verifies.
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	rotated, err := tokens.LoadKeyring(config.Auth{SigningKey: edPath, VerificationKeys: []string{writePEM(t, "PUBLIC KEY", rsaPublic)}})
+	require.NoError(t, err)
+	newToken, err := rotated.Sign(claims)
+	require.NoError(t, err)
+
+	parsed := jwt.MapClaims{}
+	require.NoError(t, rotated.Parse(oldToken, parsed))
+	assert.Equal(t, 1.0, parsed["role"])
+	assert.NoError(t, rotated.Parse(newToken, jwt.MapClaims{}))
+	assert.Error(t, old.Parse(newToken, jwt.MapClaims{}), "the old keyring does not know the new key")
+
+	header, _, _ := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	assert.Equal(t, "EdDSA", header.Header["alg"])
+	header, _, _ = jwt.NewParser().ParseUnverified(oldToken, jwt.MapClaims{})
+	assert.Equal(t, "RS256", header.Header["alg"])
+
+	set := rotated.JWKS()
+	require.Len(t, set.Keys, 2)
+	kids := map[string]string{}
+	for _, k := range set.Keys {
+		kids[k.Alg] = k.ID
+		assert.Equal(t, "sig", k.Use)
+	}
+	assert.Equal(t, header.Header["kid"], kids["RS256"])
+	assert.NotEmpty(t, kids["EdDSA"])
+}
+
+func TestLoadKeyringRejectsUnsupportedKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	_, err = tokens.LoadKeyring(config.Auth{SigningKey: writePEM(t, "PRIVATE KEY", ecDER)})
+	assert.ErrorContains(t, err, "unsupported key type")
+	_, err = tokens.LoadKeyring(config.Auth{SigningKey: writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(smallKey))})
+	assert.ErrorContains(t, err, "at least 2048 bits")
+	_, err = tokens.LoadKeyring(config.Auth{SigningKey: writePEM(t, "CERTIFICATE", []byte("cert"))})
+	assert.ErrorContains(t, err, "unsupported PEM block")
+	_, err = tokens.LoadKeyring(config.Auth{SigningKey: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestJWKSThumbprint(t *testing.T) {
+	// The key of the example of RFC 7638, section 3.1.
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	require.NoError(t, err)
+	_, signer, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys, err := tokens.NewKeyring(signer, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	keys.ServeJWKS(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var set tokens.JWKSet
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&set))
+
+	var found bool
+	for _, k := range set.Keys {
+		if k.KeyType == "RSA" {
+			found = true
+			assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", k.ID)
+			assert.Equal(t, "AQAB", k.E)
+		}
+	}
+	assert.True(t, found, "the verification key is published")
+}
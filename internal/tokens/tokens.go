@@ -0,0 +1,131 @@
+// Package tokens issues and verifies the JWT access tokens of the API, shared
+// by the handler issuing them and the middleware checking them.
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of an access token. The subject is the ID of the user
+// the token was issued to, and the ID, the jti claim, identifies the token so
+// that it can be revoked.
+type Claims struct {
+	Role int `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Validate rejects the claims without the subject, role or ID every access
+// token carries. It is called by the parser after the registered claims are
+// checked.
+func (c *Claims) Validate() error {
+	if _, err := strconv.Atoi(c.Subject); err != nil {
+		return fmt.Errorf("subject %q is not a user ID", c.Subject)
+	}
+	if c.Role <= 0 {
+		return errors.New("role missing")
+	}
+	if c.ID == "" {
+		return errors.New("jti missing")
+	}
+	return nil
+}
+
+// UserID returns the ID of the user the token was issued to.
+func (c *Claims) UserID() int {
+	id, _ := strconv.Atoi(c.Subject)
+	return id
+}
+
+// Authority issues access tokens signed with the signing key of its keyring
+// and verifies the tokens signed with any of its keys.
+type Authority struct {
+	keys      *Keyring
+	issuer    string
+	audience  string
+	ttl       time.Duration
+	clockSkew time.Duration
+}
+
+// NewAuthority returns an authority issuing tokens for the issuer and the
+// audience of cfg that expire after cfg.TokenTTL.
+func NewAuthority(keys *Keyring, cfg config.Auth) *Authority {
+	return &Authority{
+		keys:      keys,
+		issuer:    cfg.Issuer,
+		audience:  cfg.Audience,
+		ttl:       cfg.TokenTTL,
+		clockSkew: cfg.ClockSkew,
+	}
+}
+
+// GenerateToken returns a new access token of the user userID with role.
+func (a *Authority) GenerateToken(userID int, role int) (string, error) {
+	jti, err := NewID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return a.keys.Sign(&Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    a.issuer,
+			Audience:  jwt.ClaimStrings{a.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(a.ttl)),
+			ID:        jti,
+		},
+	})
+}
+
+// ParseToken verifies tokenString and returns its claims. The token must be
+// signed with RS256 or EdDSA by one of the keys, be issued by and for this
+// authority and be valid now, give or take the clock skew. Invalid claims are
+// reported with an error wrapping jwt.ErrTokenInvalidClaims.
+func (a *Authority) ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	err := a.keys.Parse(tokenString, claims,
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(a.clockSkew),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// NewID returns a random 128-bit identifier in hex.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims of the access token of
+// its request.
+func NewContext(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the claims stored in ctx by NewContext.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(contextKey{}).(*Claims)
+	return c, ok
+}
@@ -0,0 +1,92 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/axywe/filmotheka_vk/internal/tracing"
+	"github.com/axywe/filmotheka_vk/pkg/actor"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/storage/sqlstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var ctx = context.Background()
+
+func TestNewExporter(t *testing.T) {
+	exporter, err := tracing.NewExporter(ctx, config.Tracing{Exporter: "none"}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	_, err = tracing.NewExporter(ctx, config.Tracing{Exporter: "jaeger"}, nil)
+	assert.ErrorContains(t, err, `unknown trace exporter "jaeger"`)
+
+	var out bytes.Buffer
+	exporter, err = tracing.NewExporter(ctx, config.Tracing{Exporter: "stdout"}, &out)
+	require.NoError(t, err)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer("test").Start(ctx, "exported span")
+	span.End()
+	require.NoError(t, provider.Shutdown(ctx))
+	assert.Contains(t, out.String(), `"Name":"exported span"`)
+}
+
+func TestMiddlewareTracesRequestsAndStatements(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "tracing.db"), true)
+	require.NoError(t, err)
+	defer db.Close()
+	store := sqlstore.New(db, sqlstore.SQLite)
+	_, err = store.CreateActor(ctx, actor.Actor{Name: "Traced Actor", Gender: "Female"})
+	require.NoError(t, err)
+
+	h := tracing.Middleware("/actors", actor.NewHandler(store))
+	req := httptest.NewRequest(http.MethodGet, "/actors", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var server sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "GET /actors" {
+			server = span
+		}
+	}
+	require.NotNil(t, server, "the request has a server span")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String(), "the trace of the caller is continued")
+	assert.Contains(t, server.Attributes(), semconv.HTTPRoute("/actors"))
+
+	var statements []string
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Key == "db.statement" {
+				statements = append(statements, attr.Value.AsString())
+			}
+		}
+	}
+	assert.Contains(t, statements, "SELECT COUNT(*) FROM actors")
+	assert.True(t, len(statements) >= 3, "every statement has a child span: %q", statements)
+	for _, statement := range statements {
+		assert.True(t, strings.HasPrefix(statement, "SELECT"), statement)
+	}
+}
@@ -0,0 +1,56 @@
+// Package version describes the running build.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and BuildTime are set at link time:
+//
+//	go build -ldflags "-X github.com/axywe/filmotheka_vk/internal/version.Commit=$(git rev-parse HEAD)
+//	  -X github.com/axywe/filmotheka_vk/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When they are not, the VCS information recorded by the Go toolchain is used.
+var (
+	Commit    string
+	BuildTime string
+)
+
+// Info identifies a build.
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+	// Modified reports uncommitted changes in the source tree, when known.
+	Modified bool `json:"modified,omitempty"`
+}
+
+// Get returns the description of the running build. Unknown members are
+// "unknown".
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
@@ -1,16 +1,15 @@
 package actor
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
 	"github.com/axywe/filmotheka_vk/util"
-	"github.com/lib/pq"
 )
 
 type Actor struct {
@@ -27,11 +26,11 @@ type MovieBrief struct {
 }
 
 type Handler struct {
-	db *sql.DB
+	store ActorStore
 }
 
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{db: db}
+func NewHandler(store ActorStore) *Handler {
+	return &Handler{store: store}
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -49,6 +48,70 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ServeItem handles requests addressed to a single actor, /actors/{id}.
+func (h *Handler) ServeItem(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getActor(w, r)
+	case http.MethodPut:
+		h.replaceActor(w, r)
+	case http.MethodPatch:
+		h.patchActor(w, r)
+	case http.MethodDelete:
+		h.deleteActorByID(w, r)
+	default:
+		util.SendJSONError(w, r, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+	}
+}
+
+// ActorPatch is a JSON merge patch (RFC 7396) for an actor. Members left out
+// of the patch keep their value, null clears the gender or the filmography.
+type ActorPatch struct {
+	ID        util.Optional[int]          `json:"id" swaggertype:"integer"`
+	Name      util.Optional[string]       `json:"name" swaggertype:"string"`
+	Gender    util.Optional[string]       `json:"gender" swaggertype:"string"`
+	Birthdate util.Optional[time.Time]    `json:"birthdate" swaggertype:"string" format:"date-time"`
+	Movies    util.Optional[[]MovieBrief] `json:"movies" swaggertype:"array,object"`
+}
+
+// Apply merges the patch into a.
+func (p ActorPatch) Apply(a *Actor) error {
+	if p.Name.Null || p.Birthdate.Null {
+		return storage.Invalid("Name and birthdate cannot be null")
+	}
+	if p.Name.Set {
+		a.Name = p.Name.Value
+	}
+	if p.Gender.Set {
+		a.Gender = p.Gender.Value
+	}
+	if p.Birthdate.Set {
+		a.Birthdate = p.Birthdate.Value
+	}
+	if p.Movies.Set {
+		a.Movies = p.Movies.Value
+		if a.Movies == nil {
+			a.Movies = []MovieBrief{}
+		}
+	}
+	return nil
+}
+
+func validateActor(a Actor) error {
+	if a.Name == "" {
+		return storage.Invalid("Name is required")
+	} else if len([]rune(a.Name)) > 255 {
+		return storage.Invalid("Name must be less than 255 characters")
+	}
+	if len([]rune(a.Gender)) > 50 {
+		return storage.Invalid("Gender must be less than 50 characters")
+	}
+	if a.Birthdate.IsZero() {
+		return storage.Invalid("Birthdate is required")
+	}
+	return nil
+}
+
 // @Summary Create a new actor
 // @Security ApiKeyAuth
 // @Tags Actors
@@ -67,121 +130,167 @@ func (h *Handler) createActor(w http.ResponseWriter, r *http.Request) {
 		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	sqlStatement := `INSERT INTO actors (name, gender, birthdate) VALUES ($1, $2, $3) RETURNING id`
-	id := 0
-	err := h.db.QueryRow(sqlStatement, a.Name, a.Gender, a.Birthdate).Scan(&id)
-	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+	if err := validateActor(a); err != nil {
+		sendError(w, r, err)
 		return
 	}
 
-	a.ID = id
-
-	for _, movie := range a.Movies {
-		sqlStatement := `INSERT INTO actor_movie (actor_id, movie_id) VALUES ($1, $2)`
-		_, err := h.db.Exec(sqlStatement, a.ID, movie.ID)
-		if err != nil {
-			if pqErr, ok := err.(*pq.Error); ok { 
-				switch pqErr.Code {
-				case "23503":
-					util.SendJSONError(w, r, "Foreign key constraint violation", http.StatusBadRequest)
-					return
-				default:
-					util.SendJSONError(w, r, "Internal server error", http.StatusInternalServerError)
-					return
-				}
-			}
-			util.SendJSONError(w, r, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+	created, err := h.store.CreateActor(r.Context(), a)
+	if err != nil {
+		sendError(w, r, err)
+		return
 	}
 
-	util.SendJSONResponse(w, r, a, http.StatusCreated)
+	util.SendJSONResponse(w, r, created, http.StatusCreated)
 }
 
 // @Summary Update an actor
+// @Description Deprecated: use PATCH /actors/{id}. The actor ID is taken from the request body,
+// @Description the other members are merged into the stored actor like a merge patch.
 // @Security ApiKeyAuth
 // @Tags Actors
 // @Accept json
 // @Produce json
-// @Param actor body Actor true "Actor with updated information"
+// @Param actor body ActorPatch true "Actor ID and the members to change"
 // @Success 200 {object} Actor "Actor updated"
 // @Failure 400 {object} util.ErrorResponse "Bad request"
 // @Failure 401 {object} util.ErrorResponse "Not authorized"
 // @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Actor not found"
 // @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Deprecated
 // @Router /actors [put]
 func (h *Handler) updateActor(w http.ResponseWriter, r *http.Request) {
+	var patch ActorPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.ID.Value < 1 {
+		util.SendJSONError(w, r, "Actor ID is required", http.StatusBadRequest)
+		return
+	}
+
+	util.MarkDeprecated(w, fmt.Sprintf("/actors/%d", patch.ID.Value))
+	h.applyActorPatch(w, r, patch.ID.Value, patch)
+}
+
+// @Summary Replace an actor
+// @Description Replaces every member of the actor, including their filmography. Members left out are reset.
+// @Security ApiKeyAuth
+// @Tags Actors
+// @Accept json
+// @Produce json
+// @Param id path int true "Actor ID"
+// @Param actor body Actor true "Complete actor"
+// @Success 200 {object} Actor "Actor as stored"
+// @Failure 400 {object} util.ErrorResponse "Bad request or ID mismatch between path and body"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Actor not found"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /actors/{id} [put]
+func (h *Handler) replaceActor(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var a Actor
 	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
 		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	fields := []string{}
-	args := []interface{}{a.ID}
-
-	if a.Name != "" {
-		fields = append(fields, fmt.Sprintf("name = $%d", len(args)+1))
-		args = append(args, a.Name)
+	if a.ID != 0 && a.ID != id {
+		util.SendJSONError(w, r, "Actor ID in the body does not match the path", http.StatusBadRequest)
+		return
 	}
-	if a.Gender != "" {
-		fields = append(fields, fmt.Sprintf("gender = $%d", len(args)+1))
-		args = append(args, a.Gender)
+	a.ID = id
+	if a.Movies == nil {
+		a.Movies = []MovieBrief{}
 	}
-	if !a.Birthdate.IsZero() {
-		fields = append(fields, fmt.Sprintf("birthdate = $%d", len(args)+1))
-		args = append(args, a.Birthdate)
+	if err := validateActor(a); err != nil {
+		sendError(w, r, err)
+		return
 	}
 
-	if len(fields) > 0 {
-		sqlStatement := fmt.Sprintf("UPDATE actors SET %s WHERE id = $1;", strings.Join(fields, ", "))
-		_, err := h.db.Exec(sqlStatement, args...)
-		if err != nil {
-			util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	saved, err := h.store.SaveActor(r.Context(), a)
+	if err != nil {
+		sendError(w, r, err)
+		return
 	}
+	util.SendJSONResponse(w, r, saved, http.StatusOK)
+}
 
-	existingMovies, err := h.getMoviesForActor(a.ID)
+// @Summary Partially update an actor
+// @Description Applies a JSON merge patch (RFC 7396): members left out keep their value,
+// @Description null clears the gender or the filmography. The filmography, when given, is replaced as a whole.
+// @Security ApiKeyAuth
+// @Tags Actors
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "Actor ID"
+// @Param actor body ActorPatch true "Members to change"
+// @Success 200 {object} Actor "Actor as stored"
+// @Failure 400 {object} util.ErrorResponse "Bad request or ID mismatch between path and body"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Actor not found"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /actors/{id} [patch]
+func (h *Handler) patchActor(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	existingMovieMap := make(map[int]bool)
-	for _, m := range existingMovies {
-		existingMovieMap[m.ID] = true
-	}
-	for _, movie := range a.Movies {
-		if existingMovieMap[movie.ID] {
-			_, err := h.db.Exec("DELETE FROM actor_movie WHERE actor_id = $1 AND movie_id = $2", a.ID, movie.ID)
-			if err != nil {
-				util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			_, err := h.db.Exec("INSERT INTO actor_movie (actor_id, movie_id) VALUES ($1, $2)", a.ID, movie.ID)
-			if err != nil {
-				util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-		delete(existingMovieMap, movie.ID)
+	var patch ActorPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.ID.Set && patch.ID.Value != id {
+		util.SendJSONError(w, r, "Actor ID in the body does not match the path", http.StatusBadRequest)
+		return
 	}
 
-	for remainingMovieID := range existingMovieMap {
-		_, err := h.db.Exec("DELETE FROM actor_movie WHERE actor_id = $1 AND movie_id = $2", a.ID, remainingMovieID)
-		if err != nil {
-			util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
-			return
+	h.applyActorPatch(w, r, id, patch)
+}
+
+func (h *Handler) applyActorPatch(w http.ResponseWriter, r *http.Request, id int, patch ActorPatch) {
+	saved, err := h.store.UpdateActor(r.Context(), id, func(a *Actor) error {
+		if err := patch.Apply(a); err != nil {
+			return err
 		}
+		return validateActor(*a)
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
 	}
+	util.SendJSONResponse(w, r, saved, http.StatusOK)
+}
 
-	util.SendJSONResponse(w, r, a, http.StatusOK)
+// sendError responds to a failed operation with the matching status code.
+func sendError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *storage.InvalidError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		util.SendJSONError(w, r, "Actor not found", http.StatusNotFound)
+	case errors.As(err, &invalid):
+		util.SendJSONError(w, r, invalid.Message, http.StatusBadRequest)
+	case errors.Is(err, storage.ErrConflict):
+		util.SendJSONError(w, r, err.Error(), http.StatusConflict)
+	default:
+		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 // @Summary Delete an actor
+// @Description Deprecated: use DELETE /actors/{id}.
 // @Security ApiKeyAuth
 // @Tags Actors
 // @Param id query int true "Account ID"
@@ -191,103 +300,123 @@ func (h *Handler) updateActor(w http.ResponseWriter, r *http.Request) {
 // @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
 // @Failure 404 {object} util.ErrorResponse "Actor not found"
 // @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Deprecated
 // @Router /actors [delete]
 func (h *Handler) deleteActor(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
+	idParam := r.URL.Query().Get("id")
+	if idParam == "" {
 		util.SendJSONError(w, r, "Actor ID is required", http.StatusBadRequest)
 		return
 	}
-
-	sqlStatement := `DELETE FROM actor_movie WHERE actor_id = $1;`
-	_, err := h.db.Exec(sqlStatement, id)
+	id, err := util.ParseID(idParam)
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	sqlStatement = `DELETE FROM actors WHERE id = $1;`
-	result, err := h.db.Exec(sqlStatement, id)
+	util.MarkDeprecated(w, fmt.Sprintf("/actors/%d", id))
+	h.removeActor(w, r, id)
+}
+
+// @Summary Delete an actor by ID
+// @Security ApiKeyAuth
+// @Tags Actors
+// @Param id path int true "Actor ID"
+// @Success 200 {string} string "Actor deleted"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Actor not found"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /actors/{id} [delete]
+func (h *Handler) deleteActorByID(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+	h.removeActor(w, r, id)
+}
+
+func (h *Handler) removeActor(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.store.DeleteActor(r.Context(), id); err != nil {
+		sendError(w, r, err)
 		return
 	}
-	if rowsAffected == 0 {
-		util.SendJSONError(w, r, "Actor not found", http.StatusNotFound)
+
+	util.SendJSONResponse(w, r, "Actor deleted", http.StatusOK)
+}
+
+// @Summary Get an actor
+// @Security ApiKeyAuth
+// @Tags Actors
+// @Produce json
+// @Param id path int true "Actor ID"
+// @Success 200 {object} Actor "Actor with their filmography"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 404 {object} util.ErrorResponse "Actor not found"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /actors/{id} [get]
+func (h *Handler) getActor(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	util.SendJSONResponse(w, r, "Actor deleted", http.StatusOK)
+	a, err := h.store.GetActor(r.Context(), id)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, a, http.StatusOK)
 }
 
 // @Summary Get list of actors
 // @Security ApiKeyAuth
 // @Tags Actors
 // @Produce json
+// @Param limit query int false "Page size, from 1 to 100"
+// @Param offset query int false "Number of actors to skip"
+// @Param cursor query string false "Opaque cursor taken from the Link header of a previous page"
 // @Success 200 {array} Actor "List of actors"
+// @Header 200 {integer} X-Total-Count "Total number of actors"
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Failure 400 {object} util.ErrorResponse "Invalid pagination parameters"
 // @Failure 401 {object} util.ErrorResponse "Not authorized"
 // @Failure 404 {object} util.ErrorResponse "No actors found"
 // @Failure 500 {object} util.ErrorResponse "Internal server error"
 // @Router /actors [get]
 func (h *Handler) getActors(w http.ResponseWriter, r *http.Request) {
-	var actors []Actor
-
-	rows, err := h.db.Query("SELECT id, name, gender, birthdate FROM actors")
+	page, err := query.ParsePage(r.URL.Query())
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var a Actor
-		err := rows.Scan(&a.ID, &a.Name, &a.Gender, &a.Birthdate)
-		if err != nil {
-			util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		actors = append(actors, a)
+	if page.Cursor != nil && (page.Cursor.SortBy != "id" || page.Cursor.Desc) {
+		util.SendJSONError(w, r, "Cursor does not match the requested sort order", http.StatusBadRequest)
+		return
 	}
 
-	for i, actor := range actors {
-		actorMovies, err := h.getMoviesForActor(actor.ID)
-		if err != nil {
-			log.Println("Error fetching movies for actor:", err)
-			continue
-		}
-		actors[i].Movies = actorMovies
+	list, err := h.store.ListActors(r.Context(), ActorQuery{Page: page})
+	if err != nil {
+		sendError(w, r, err)
+		return
 	}
-	if actors == nil {
+	if list.Total == 0 {
 		util.SendJSONError(w, r, "No actors found", http.StatusNotFound)
 		return
 	}
 
-	util.SendJSONResponse(w, r, actors, http.StatusOK)
-}
-
-func (h *Handler) getMoviesForActor(actorID int) ([]MovieBrief, error) {
-	var movies []MovieBrief
-
-	sqlStatement := `SELECT m.id, m.title FROM movies m JOIN actor_movie am ON am.movie_id = m.id WHERE am.actor_id = $1;`
-	rows, err := h.db.Query(sqlStatement, actorID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var m MovieBrief
-		if err := rows.Scan(&m.ID, &m.Title); err != nil {
-			return nil, err
-		}
-		movies = append(movies, m)
+	actors := list.Actors
+	var first, last *query.Cursor
+	if len(actors) > 0 {
+		first = &query.Cursor{SortBy: "id", ID: actors[0].ID, Before: true}
+		last = &query.Cursor{SortBy: "id", ID: actors[len(actors)-1].ID}
 	}
-
-	return movies, nil
+	next, prev := page.Neighbours(list.Total, list.More, first, last)
+	util.SetPaginationHeaders(w, r, list.Total, next, prev)
+	util.SendJSONResponse(w, r, actors, http.StatusOK)
 }
@@ -2,8 +2,10 @@ package actor_test
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -13,13 +15,18 @@ import (
 
 	actor "github.com/axywe/filmotheka_vk/pkg/actor"
 	movie "github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/storage/sqlstore"
 	testutils "github.com/axywe/filmotheka_vk/testutils"
 
-	_ "github.com/lib/pq"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
-func createActor(t *testing.T, db *sql.DB, actorDetails actor.Actor) int {
-	actorHandler := actor.NewHandler(db)
+var ctx = context.Background()
+
+func createActor(t *testing.T, store actor.ActorStore, actorDetails actor.Actor) int {
+	actorHandler := actor.NewHandler(store)
 
 	body, err := json.Marshal(actorDetails)
 	if err != nil {
@@ -47,8 +54,7 @@ func createActor(t *testing.T, db *sql.DB, actorDetails actor.Actor) int {
 }
 
 func TestCreateActor(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
 	newMovie1 := movie.Movie{
 		Title:       "Movie 1",
@@ -56,7 +62,7 @@ func TestCreateActor(t *testing.T) {
 		ReleaseDate: time.Now(),
 		Rating:      5.0,
 	}
-	movie1ID := testutils.CreateMovie(t, db, newMovie1)
+	movie1ID := testutils.CreateMovie(t, store, newMovie1)
 
 	newMovie2 := movie.Movie{
 		Title:       "Movie 2",
@@ -64,16 +70,11 @@ func TestCreateActor(t *testing.T) {
 		ReleaseDate: time.Now(),
 		Rating:      5.0,
 	}
-	movie2ID := testutils.CreateMovie(t, db, newMovie2)
+	movie2ID := testutils.CreateMovie(t, store, newMovie2)
 
-	h := actor.NewHandler(db)
+	h := actor.NewHandler(store)
 
-	var notMovie int
-	err := db.QueryRow("SELECT MAX(id) FROM movies").Scan(&notMovie)
-	if err != nil {
-		t.Errorf("Error searching max id from movie: %v", err)
-	}
-	notMovie++
+	notMovie := movie2ID + 1
 	user := actor.Actor{
 		Name:      "John Doe",
 		Gender:    "Male",
@@ -106,10 +107,7 @@ func TestCreateActor(t *testing.T) {
 		Name:      "John Doe",
 		Gender:    "Male",
 		Birthdate: time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC),
-		Movies: []actor.MovieBrief{
-			{ID: movie1ID, Title: "Movie 1"},
-			{ID: movie2ID, Title: "Movie 2"},
-		},
+		Movies:    []actor.MovieBrief{{ID: movie1ID}, {ID: movie2ID}},
 	}
 
 	body, err = json.Marshal(user)
@@ -137,24 +135,34 @@ func TestCreateActor(t *testing.T) {
 	if newActor.ID == 0 {
 		t.Errorf("Expected non-zero actor ID")
 	}
+	if len(newActor.Movies) != 2 || newActor.Movies[0].Title != "Movie 1" || newActor.Movies[1].Title != "Movie 2" {
+		t.Errorf("Expected the filmography with its titles, got %+v", newActor.Movies)
+	}
 
-	var actorCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM actors WHERE id = $1", newActor.ID).Scan(&actorCount)
-	if err != nil || actorCount != 1 {
+	stored, err := store.GetActor(ctx, newActor.ID)
+	if err != nil {
 		t.Errorf("Actor was not created: %v", err)
 	}
+	if len(stored.Movies) != 2 {
+		t.Errorf("The actor is not associated with the films: %v", stored.Movies)
+	}
 
-	err = db.QueryRow("SELECT COUNT(*) FROM actor_movie WHERE actor_id = $1", newActor.ID).Scan(&actorCount)
-	if err != nil || actorCount != 2 {
-		t.Errorf("The actor is not associated with the films: %v", err)
+	list, err := store.ListActors(ctx, actor.ActorQuery{})
+	if err != nil || list.Total != 1 {
+		t.Errorf("Expected the rejected actor to be rolled back, got %d actors: %v", list.Total, err)
 	}
 }
 
 func TestGetActors(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := actor.NewHandler(db)
+	h := actor.NewHandler(store)
+
+	createActor(t, store, actor.Actor{
+		Name:      "John Doe",
+		Gender:    "Male",
+		Birthdate: time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
 
 	req, err := http.NewRequest(http.MethodGet, "/actors", nil)
 	if err != nil {
@@ -179,10 +187,9 @@ func TestGetActors(t *testing.T) {
 }
 
 func TestUnknownMethod(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := actor.NewHandler(db)
+	h := actor.NewHandler(store)
 
 	req, err := http.NewRequest(http.MethodPatch, "/actors", nil)
 	if err != nil {
@@ -198,10 +205,9 @@ func TestUnknownMethod(t *testing.T) {
 }
 
 func TestUpdateActor(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := actor.NewHandler(db)
+	h := actor.NewHandler(store)
 
 	newMovie1 := movie.Movie{
 		Title:       "Movie 1",
@@ -209,7 +215,7 @@ func TestUpdateActor(t *testing.T) {
 		ReleaseDate: time.Now(),
 		Rating:      5.0,
 	}
-	movie1ID := testutils.CreateMovie(t, db, newMovie1)
+	movie1ID := testutils.CreateMovie(t, store, newMovie1)
 
 	newMovie2 := movie.Movie{
 		Title:       "Movie 2",
@@ -217,7 +223,7 @@ func TestUpdateActor(t *testing.T) {
 		ReleaseDate: time.Now(),
 		Rating:      5.0,
 	}
-	movie2ID := testutils.CreateMovie(t, db, newMovie2)
+	movie2ID := testutils.CreateMovie(t, store, newMovie2)
 
 	newMovie3 := movie.Movie{
 		Title:       "Movie 3",
@@ -225,7 +231,7 @@ func TestUpdateActor(t *testing.T) {
 		ReleaseDate: time.Now(),
 		Rating:      5.0,
 	}
-	movie3ID := testutils.CreateMovie(t, db, newMovie3)
+	movie3ID := testutils.CreateMovie(t, store, newMovie3)
 
 	user := actor.Actor{
 		Name:      "John Doe",
@@ -237,7 +243,7 @@ func TestUpdateActor(t *testing.T) {
 		},
 	}
 
-	actorID := createActor(t, db, user)
+	actorID := createActor(t, store, user)
 
 	updatedActor := actor.Actor{
 		ID:        actorID,
@@ -278,10 +284,9 @@ func TestUpdateActor(t *testing.T) {
 }
 
 func TestDeleteActor(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := actor.NewHandler(db)
+	h := actor.NewHandler(store)
 
 	newActor := actor.Actor{
 		Name:      "John Doe",
@@ -289,7 +294,7 @@ func TestDeleteActor(t *testing.T) {
 		Birthdate: time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC),
 	}
 
-	createdActorID := createActor(t, db, newActor)
+	createdActorID := createActor(t, store, newActor)
 
 	deleteReq, err := http.NewRequest(http.MethodDelete, "/actors", nil)
 	if err != nil {
@@ -323,9 +328,234 @@ func TestDeleteActor(t *testing.T) {
 		t.Errorf("Unexpected response body: got %v want %v", responseBody, expectedResponseBody)
 	}
 
-	var actorCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM actors WHERE id = $1", 999).Scan(&actorCount)
-	if err != nil || actorCount != 0 {
+	if _, err := store.GetActor(ctx, createdActorID); !errors.Is(err, storage.ErrNotFound) {
 		t.Errorf("Actor was not deleted: %v", err)
 	}
 }
+
+func TestGetActorsLoadsFilmographyInOneQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	birthdate := time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM actors").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT id, name, gender, birthdate FROM actors").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "gender", "birthdate"}).
+			AddRow(1, "John Doe", "Male", birthdate).
+			AddRow(2, "Jane Doe", "Female", birthdate))
+	mock.ExpectQuery("SELECT am.actor_id, m.id, m.title FROM movies m JOIN actor_movie am").
+		WillReturnRows(sqlmock.NewRows([]string{"actor_id", "id", "title"}).
+			AddRow(1, 10, "Movie 1").
+			AddRow(2, 10, "Movie 1").
+			AddRow(2, 11, "Movie 2"))
+
+	h := actor.NewHandler(sqlstore.New(db, sqlstore.Postgres))
+
+	req, err := http.NewRequest(http.MethodGet, "/actors", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var actors []actor.Actor
+	if err := json.Unmarshal(rr.Body.Bytes(), &actors); err != nil {
+		t.Fatalf("Unable to unmarshal response: %v", err)
+	}
+	if len(actors) != 2 || len(actors[0].Movies) != 1 || len(actors[1].Movies) != 2 {
+		t.Errorf("Unexpected filmographies: %+v", actors)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetActorsFailsOnFilmographyError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM actors").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT id, name, gender, birthdate FROM actors").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "gender", "birthdate"}).
+			AddRow(1, "John Doe", "Male", time.Now()))
+	mock.ExpectQuery("SELECT am.actor_id, m.id, m.title FROM movies m JOIN actor_movie am").
+		WillReturnError(sql.ErrConnDone)
+
+	h := actor.NewHandler(sqlstore.New(db, sqlstore.Postgres))
+
+	req, err := http.NewRequest(http.MethodGet, "/actors", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+	}
+}
+
+func TestGetActorByID(t *testing.T) {
+	store := testutils.SetupStore(t)
+
+	h := actor.NewHandler(store)
+
+	actorID := createActor(t, store, actor.Actor{
+		Name:      "John Doe",
+		Gender:    "Male",
+		Birthdate: time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/actors/%d", actorID), nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	req.SetPathValue("id", fmt.Sprint(actorID))
+	rr := httptest.NewRecorder()
+
+	h.ServeItem(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var a actor.Actor
+	if err := json.Unmarshal(rr.Body.Bytes(), &a); err != nil {
+		t.Fatalf("Unable to unmarshal response: %v", err)
+	}
+	if a.ID != actorID {
+		t.Errorf("Expected actor %d, got %d", actorID, a.ID)
+	}
+
+	req.SetPathValue("id", fmt.Sprint(actorID+1000000))
+	rr = httptest.NewRecorder()
+
+	h.ServeItem(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestReplaceActorNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE actors SET name = \\$2, gender = \\$3, birthdate = \\$4 WHERE id = \\$1 RETURNING").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "gender", "birthdate"}))
+	mock.ExpectRollback()
+
+	h := actor.NewHandler(sqlstore.New(db, sqlstore.Postgres))
+
+	body := `{"name": "Nobody", "gender": "", "birthdate": "1980-01-01T00:00:00Z"}`
+	req, err := http.NewRequest(http.MethodPut, "/actors/42", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	req.SetPathValue("id", "42")
+	rr := httptest.NewRecorder()
+
+	h.ServeItem(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateActorRollsBackOnMissingMovie(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO actors").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO actor_movie").WithArgs(1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO actor_movie").WithArgs(1, 11).
+		WillReturnError(&pq.Error{Code: "23503"})
+	mock.ExpectRollback()
+
+	h := actor.NewHandler(sqlstore.New(db, sqlstore.Postgres))
+
+	body := `{"name": "John Doe", "gender": "Male", "birthdate": "1980-01-01T00:00:00Z", "movies": [{"id": 10}, {"id": 11}]}`
+	req, err := http.NewRequest(http.MethodPost, "/actors", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateActorReturnsFilmography(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO actors").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO actor_movie").WithArgs(1, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT m.id, m.title FROM movies m").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(10, "Movie 10"))
+	mock.ExpectCommit()
+
+	h := actor.NewHandler(sqlstore.New(db, sqlstore.Postgres))
+
+	body := `{"name": "John Doe", "gender": "Male", "birthdate": "1980-01-01T00:00:00Z", "movies": [{"id": 10}]}`
+	req, err := http.NewRequest(http.MethodPost, "/actors", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var created actor.Actor
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Unable to unmarshal response: %v", err)
+	}
+	if len(created.Movies) != 1 || created.Movies[0] != (actor.MovieBrief{ID: 10, Title: "Movie 10"}) {
+		t.Errorf("Expected the filmography with its titles, got %+v", created.Movies)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,45 @@
+package actor
+
+import (
+	"context"
+
+	"github.com/axywe/filmotheka_vk/pkg/query"
+)
+
+// ActorStore persists actors and their filmographies. Implementations report
+// a missing actor with storage.ErrNotFound and rejected input with a
+// *storage.InvalidError.
+type ActorStore interface {
+	// ListActors returns one page of actors ordered by ID, each with their
+	// filmography.
+	ListActors(ctx context.Context, q ActorQuery) (ActorList, error)
+	// GetActor returns the actor with the given ID and their filmography.
+	GetActor(ctx context.Context, id int) (Actor, error)
+	// CreateActor stores a new actor and links them to their movies. Every
+	// movie must exist.
+	CreateActor(ctx context.Context, a Actor) (Actor, error)
+	// SaveActor overwrites every member of an existing actor and replaces
+	// their filmography when a.Movies is not nil. It returns the actor as
+	// persisted.
+	SaveActor(ctx context.Context, a Actor) (Actor, error)
+	// UpdateActor loads the actor with the given ID without their
+	// filmography, passes it to update and saves the result like SaveActor,
+	// as one unit of work. An error returned by update aborts the operation.
+	UpdateActor(ctx context.Context, id int, update func(a *Actor) error) (Actor, error)
+	// DeleteActor removes an actor and their links to movies.
+	DeleteActor(ctx context.Context, id int) error
+}
+
+// ActorQuery selects the actors returned by ListActors.
+type ActorQuery struct {
+	Page query.Page
+}
+
+// ActorList is a page of actors together with the total number of actors.
+type ActorList struct {
+	Actors []Actor
+	Total  int
+	// More reports whether there are more actors past the page, in the
+	// direction the page was read.
+	More bool
+}
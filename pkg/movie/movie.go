@@ -1,32 +1,45 @@
 package movie
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
 	"github.com/axywe/filmotheka_vk/util"
 )
 
 type Movie struct {
-	ID          int       `json:"id,omitempty"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	ReleaseDate time.Time `json:"releaseDate"`
-	Rating      float64   `json:"rating"`
+	ID          int          `json:"id,omitempty"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	ReleaseDate time.Time    `json:"releaseDate"`
+	Rating      float64      `json:"rating"`
+	Actors      []ActorBrief `json:"actors,omitempty"`
+	Match       *SearchMatch `json:"match,omitempty"`
+}
+
+// SearchMatch explains why a movie was returned by a search: whether its
+// title matched and the name of the matching cast member, if any.
+type SearchMatch struct {
+	Title bool   `json:"title"`
+	Actor string `json:"actor,omitempty"`
+}
+
+type ActorBrief struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
 }
 
 type Handler struct {
-	db *sql.DB
+	store MovieStore
 }
 
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{db: db}
+func NewHandler(store MovieStore) *Handler {
+	return &Handler{store: store}
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -44,6 +57,74 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ServeItem handles requests addressed to a single movie, /movies/{id}.
+func (h *Handler) ServeItem(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getMovie(w, r)
+	case http.MethodPut:
+		h.replaceMovie(w, r)
+	case http.MethodPatch:
+		h.patchMovie(w, r)
+	case http.MethodDelete:
+		h.deleteMovieByID(w, r)
+	default:
+		util.SendJSONError(w, r, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+	}
+}
+
+// MoviePatch is a JSON merge patch (RFC 7396) for a movie. Members left out
+// of the patch keep their value, null clears the description or the cast.
+type MoviePatch struct {
+	ID          util.Optional[int]          `json:"id" swaggertype:"integer"`
+	Title       util.Optional[string]       `json:"title" swaggertype:"string"`
+	Description util.Optional[string]       `json:"description" swaggertype:"string"`
+	ReleaseDate util.Optional[time.Time]    `json:"releaseDate" swaggertype:"string" format:"date-time"`
+	Rating      util.Optional[float64]      `json:"rating" swaggertype:"number"`
+	Actors      util.Optional[[]ActorBrief] `json:"actors" swaggertype:"array,object"`
+}
+
+// Apply merges the patch into m.
+func (p MoviePatch) Apply(m *Movie) error {
+	if p.Title.Null || p.ReleaseDate.Null || p.Rating.Null {
+		return storage.Invalid("Title, release date and rating cannot be null")
+	}
+	if p.Title.Set {
+		m.Title = p.Title.Value
+	}
+	if p.Description.Set {
+		m.Description = p.Description.Value
+	}
+	if p.ReleaseDate.Set {
+		m.ReleaseDate = p.ReleaseDate.Value
+	}
+	if p.Rating.Set {
+		m.Rating = p.Rating.Value
+	}
+	if p.Actors.Set {
+		m.Actors = p.Actors.Value
+		if m.Actors == nil {
+			m.Actors = []ActorBrief{}
+		}
+	}
+	return nil
+}
+
+func validateMovie(m Movie) error {
+	if m.Title == "" {
+		return storage.Invalid("Title is required")
+	} else if len([]rune(m.Title)) > 150 {
+		return storage.Invalid("Title must be less than 150 characters")
+	}
+	if len([]rune(m.Description)) > 1000 {
+		return storage.Invalid("Description must be less than 1000 characters")
+	}
+	if m.Rating < 0 || m.Rating > 10 {
+		return storage.Invalid("Rating must be between 0 and 10")
+	}
+	return nil
+}
+
 // @Summary Create a new movie
 // @Security ApiKeyAuth
 // @Tags Movies
@@ -62,92 +143,157 @@ func (h *Handler) createMovie(w http.ResponseWriter, r *http.Request) {
 		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if m.Title == "" {
-		util.SendJSONError(w, r, "Title is required", http.StatusBadRequest)
-		return
-	} else if len([]rune(m.Title)) > 150 {
-		util.SendJSONError(w, r, "Title must be less than 255 characters", http.StatusBadRequest)
-		return
-	}
-	if len([]rune(m.Description)) > 1000 {
-		util.SendJSONError(w, r, "Description must be less than 1000 characters", http.StatusBadRequest)
+	if err := validateMovie(m); err != nil {
+		sendError(w, r, err)
 		return
 	}
-	if m.Rating < 0 || m.Rating > 10 {
-		util.SendJSONError(w, r, "Rating must be between 0 and 10", http.StatusBadRequest)
-		return
-	}
-	sqlStatement := `INSERT INTO movies (title, description, release_date, rating) VALUES ($1, $2, $3, $4) RETURNING id`
-	id := 0
-	err := h.db.QueryRow(sqlStatement, m.Title, m.Description, m.ReleaseDate, m.Rating).Scan(&id)
+
+	created, err := h.store.CreateMovie(r.Context(), m)
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		sendError(w, r, err)
 		return
 	}
-
-	m.ID = id
-	util.SendJSONResponse(w, r, m, http.StatusCreated)
+	util.SendJSONResponse(w, r, created, http.StatusCreated)
 }
 
 // @Summary Update a movie
+// @Description Deprecated: use PATCH /movies/{id}. The movie ID is taken from the request body,
+// @Description the other members are merged into the stored movie like a merge patch.
 // @Security ApiKeyAuth
 // @Tags Movies
 // @Accept json
 // @Produce json
-// @Param movie body Movie true "Movie with updated information"
+// @Param movie body MoviePatch true "Movie ID and the members to change"
 // @Success 200 {object} Movie "Movie updated"
 // @Failure 400 "Bad request"
 // @Failure 401 {object} util.ErrorResponse "Not authorized"
 // @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Movie not found"
 // @Failure 500 "Internal server error"
+// @Deprecated
 // @Router /movies [put]
 func (h *Handler) updateMovie(w http.ResponseWriter, r *http.Request) {
-	var m Movie
-	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+	var patch MoviePatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
 		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if patch.ID.Value < 1 {
+		util.SendJSONError(w, r, "Movie ID is required", http.StatusBadRequest)
+		return
+	}
+
+	util.MarkDeprecated(w, fmt.Sprintf("/movies/%d", patch.ID.Value))
+	h.applyMoviePatch(w, r, patch.ID.Value, patch)
+}
 
-	sqlStatement := "UPDATE movies SET"
-	params := []interface{}{}
-	index := 2
+// @Summary Replace a movie
+// @Description Replaces every member of the movie, including its cast. Members left out are reset. The release date is required.
+// @Security ApiKeyAuth
+// @Tags Movies
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param movie body Movie true "Complete movie"
+// @Success 200 {object} Movie "Movie as stored"
+// @Failure 400 {object} util.ErrorResponse "Bad request or ID mismatch between path and body"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Movie not found"
+// @Failure 500 "Internal server error"
+// @Router /movies/{id} [put]
+func (h *Handler) replaceMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if m.Title != "" {
-		sqlStatement += " title = $" + strconv.Itoa(index) + ","
-		params = append(params, m.Title)
-		index++
+	var m Movie
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if m.Description != "" {
-		sqlStatement += " description = $" + strconv.Itoa(index) + ","
-		params = append(params, m.Description)
-		index++
+	if m.ID != 0 && m.ID != id {
+		util.SendJSONError(w, r, "Movie ID in the body does not match the path", http.StatusBadRequest)
+		return
 	}
-	if !m.ReleaseDate.IsZero() {
-		sqlStatement += " release_date = $" + strconv.Itoa(index) + ","
-		params = append(params, m.ReleaseDate)
-		index++
+	m.ID = id
+	if m.Actors == nil {
+		m.Actors = []ActorBrief{}
 	}
-	if m.Rating != 0 {
-		sqlStatement += " rating = $" + strconv.Itoa(index) + ","
-		params = append(params, m.Rating)
+	// A replacement resets the members left out, which would silently clear
+	// the release date of a client that forgot it.
+	if m.ReleaseDate.IsZero() {
+		util.SendJSONError(w, r, "Release date is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateMovie(m); err != nil {
+		sendError(w, r, err)
+		return
 	}
 
-	sqlStatement = strings.TrimSuffix(sqlStatement, ",")
+	saved, err := h.store.SaveMovie(r.Context(), m)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, saved, http.StatusOK)
+}
 
-	sqlStatement += " WHERE id = $1;"
+// @Summary Partially update a movie
+// @Description Applies a JSON merge patch (RFC 7396): members left out keep their value,
+// @Description null clears the description or the cast. The cast, when given, is replaced as a whole.
+// @Security ApiKeyAuth
+// @Tags Movies
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param movie body MoviePatch true "Members to change"
+// @Success 200 {object} Movie "Movie as stored"
+// @Failure 400 {object} util.ErrorResponse "Bad request or ID mismatch between path and body"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Movie not found"
+// @Failure 500 "Internal server error"
+// @Router /movies/{id} [patch]
+func (h *Handler) patchMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	params = append([]interface{}{m.ID}, params...)
+	var patch MoviePatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.ID.Set && patch.ID.Value != id {
+		util.SendJSONError(w, r, "Movie ID in the body does not match the path", http.StatusBadRequest)
+		return
+	}
+
+	h.applyMoviePatch(w, r, id, patch)
+}
 
-	_, err := h.db.Exec(sqlStatement, params...)
+func (h *Handler) applyMoviePatch(w http.ResponseWriter, r *http.Request, id int, patch MoviePatch) {
+	saved, err := h.store.UpdateMovie(r.Context(), id, func(m *Movie) error {
+		if err := patch.Apply(m); err != nil {
+			return err
+		}
+		return validateMovie(*m)
+	})
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		sendError(w, r, err)
 		return
 	}
-
-	util.SendJSONResponse(w, r, m, http.StatusOK)
+	util.SendJSONResponse(w, r, saved, http.StatusOK)
 }
 
 // @Summary Delete a movie
+// @Description Deprecated: use DELETE /movies/{id}.
 // @Security ApiKeyAuth
 // @Tags Movies
 // @Param id query int true "Movie ID"
@@ -157,94 +303,225 @@ func (h *Handler) updateMovie(w http.ResponseWriter, r *http.Request) {
 // @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
 // @Failure 404 {object} util.ErrorResponse "Movie not found"
 // @Failure 500 "Internal server error"
+// @Deprecated
 // @Router /movies [delete]
 func (h *Handler) deleteMovie(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
+	idParam := r.URL.Query().Get("id")
+	if idParam == "" {
 		util.SendJSONError(w, r, "Movie ID is required", http.StatusBadRequest)
 		return
 	}
-
-	sqlStatement := `DELETE FROM actor_movie WHERE movie_id = $1;`
-	_, err := h.db.Exec(sqlStatement, id)
+	id, err := util.ParseID(idParam)
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	sqlStatement = `DELETE FROM movies WHERE id = $1;`
-	result, err := h.db.Exec(sqlStatement, id)
+	util.MarkDeprecated(w, fmt.Sprintf("/movies/%d", id))
+	h.removeMovie(w, r, id)
+}
+
+// @Summary Delete a movie by ID
+// @Security ApiKeyAuth
+// @Tags Movies
+// @Param id path int true "Movie ID"
+// @Success 200 "Movie deleted"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Movie not found"
+// @Failure 500 "Internal server error"
+// @Router /movies/{id} [delete]
+func (h *Handler) deleteMovieByID(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+	h.removeMovie(w, r, id)
+}
+
+func (h *Handler) removeMovie(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.store.DeleteMovie(r.Context(), id); err != nil {
+		sendError(w, r, err)
 		return
 	}
-	if rowsAffected == 0 {
+
+	util.SendJSONResponse(w, r, "Movie deleted", http.StatusOK)
+}
+
+// sendError responds to a failed operation with the matching status code.
+func sendError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *storage.InvalidError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
 		util.SendJSONError(w, r, "Movie not found", http.StatusNotFound)
+	case errors.As(err, &invalid):
+		util.SendJSONError(w, r, invalid.Message, http.StatusBadRequest)
+	case errors.Is(err, storage.ErrConflict):
+		util.SendJSONError(w, r, err.Error(), http.StatusConflict)
+	default:
+		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// @Summary Get a movie
+// @Security ApiKeyAuth
+// @Tags Movies
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 200 {object} Movie "Movie with its cast"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 404 {object} util.ErrorResponse "Movie not found"
+// @Failure 500 "Internal server error"
+// @Router /movies/{id} [get]
+func (h *Handler) getMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	util.SendJSONResponse(w, r, "Movie deleted", http.StatusOK)
+	m, err := h.store.GetMovie(r.Context(), id)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, m, http.StatusOK)
 }
 
 // @Summary Get list of movies
+// @Description Movies can be searched by a fragment of the title (search), by a fragment of an actor's name (actor) or by both at once (q).
+// @Description Every search hit carries a match object telling whether the title matched and which actor matched.
 // @Security ApiKeyAuth
 // @Tags Movies
 // @Produce json
+// @Param search query string false "Fragment of the movie title"
+// @Param actor query string false "Fragment of an actor's name"
+// @Param q query string false "Fragment of the movie title or of an actor's name"
+// @Param sortBy query string false "Sort field: title, rating or release_date"
+// @Param sortOrder query string false "Sort order: asc or desc"
+// @Param limit query int false "Page size, from 1 to 100"
+// @Param offset query int false "Number of movies to skip"
+// @Param cursor query string false "Opaque cursor taken from the Link header of a previous page"
 // @Success 200 {array} Movie "List of movies"
+// @Header 200 {integer} X-Total-Count "Total number of matching movies"
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Failure 400 {object} util.ErrorResponse "Invalid pagination parameters"
 // @Failure 401 {object} util.ErrorResponse "Not authorized"
-// @Failure 404 {object} util.ErrorResponse "No actors found"
+// @Failure 404 {object} util.ErrorResponse "No movies found"
 // @Failure 500 "Internal server error"
 // @Router /movies [get]
 func (h *Handler) getMovies(w http.ResponseWriter, r *http.Request) {
-	query := "SELECT id, title, description, release_date, rating FROM movies"
-
-	search := r.URL.Query().Get("search")
-	if search != "" {
-		query += fmt.Sprintf(" WHERE title ILIKE '%%%s%%'", search)
+	page, err := query.ParsePage(r.URL.Query())
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	sortBy := r.URL.Query().Get("sortBy")
-	if sortBy != "title" && sortBy != "rating" && sortBy != "release_date" {
-		sortBy = "rating"
+	q := MovieQuery{
+		Title: r.URL.Query().Get("search"),
+		Actor: r.URL.Query().Get("actor"),
+		Any:   r.URL.Query().Get("q"),
+		Page:  page,
+	}
+	q.SortBy = r.URL.Query().Get("sortBy")
+	if !sortFields[q.SortBy] {
+		q.SortBy = "rating"
 	}
 	sortOrder := r.URL.Query().Get("sortOrder")
-	if sortOrder == "desc" || (sortBy == "rating" && sortOrder != "asc") {
-		sortBy += " DESC"
-	} else {
-		sortBy += " ASC"
+	q.Desc = sortOrder == "desc" || (q.SortBy == "rating" && sortOrder != "asc")
+
+	if page.Cursor != nil {
+		q.SeekValue, err = cursorValue(*page.Cursor, q.SortBy, q.Desc)
+		if err != nil {
+			util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
-	query += fmt.Sprintf(" ORDER BY %s", sortBy)
-	log.Println(query)
-	rows, err := h.db.Query(query)
+	list, err := h.store.ListMovies(r.Context(), q)
 	if err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+		sendError(w, r, err)
+		return
+	}
+	if list.Total == 0 {
+		util.SendJSONError(w, r, "No movies found", http.StatusNotFound)
 		return
 	}
-	defer rows.Close()
 
-	movies := []Movie{}
-	for rows.Next() {
-		var m Movie
-		if err := rows.Scan(&m.ID, &m.Title, &m.Description, &m.ReleaseDate, &m.Rating); err != nil {
+	movies := list.Movies
+	var first, last *query.Cursor
+	if len(movies) > 0 {
+		first, err = movieCursor(movies[0], q.SortBy, q.Desc, true)
+		if err == nil {
+			last, err = movieCursor(movies[len(movies)-1], q.SortBy, q.Desc, false)
+		}
+		if err != nil {
 			util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		movies = append(movies, m)
 	}
-	if err := rows.Err(); err != nil {
-		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
-		return
+
+	next, prev := page.Neighbours(list.Total, list.More, first, last)
+	util.SetPaginationHeaders(w, r, list.Total, next, prev)
+	util.SendJSONResponse(w, r, movies, http.StatusOK)
+}
+
+// movieCursor returns a cursor positioned at m under the given ordering.
+func movieCursor(m Movie, sortBy string, desc, before bool) (*query.Cursor, error) {
+	var value interface{}
+	switch sortBy {
+	case "title":
+		value = m.Title
+	case "release_date":
+		value = m.ReleaseDate
+	default:
+		value = m.Rating
 	}
-	if len(movies) == 0 {
-		util.SendJSONError(w, r, "No movies found", http.StatusNotFound)
-		return
+	c, err := query.NewCursor(sortBy, desc, value, m.ID, before)
+	if err != nil {
+		return nil, err
 	}
-	util.SendJSONResponse(w, r, movies, http.StatusOK)
+	return &c, nil
+}
+
+// cursorValue checks that c was issued for the requested ordering and
+// decodes the sort value it carries.
+func cursorValue(c query.Cursor, sortBy string, desc bool) (interface{}, error) {
+	if c.SortBy != sortBy || c.Desc != desc {
+		return nil, fmt.Errorf("Cursor does not match the requested sort order")
+	}
+
+	var err error
+	switch sortBy {
+	case "title":
+		var title string
+		err = json.Unmarshal(c.Value, &title)
+		if err == nil {
+			return title, nil
+		}
+	case "release_date":
+		var releaseDate time.Time
+		err = json.Unmarshal(c.Value, &releaseDate)
+		if err == nil {
+			return releaseDate, nil
+		}
+	default:
+		var rating float64
+		err = json.Unmarshal(c.Value, &rating)
+		if err == nil {
+			return rating, nil
+		}
+	}
+	return nil, query.ErrInvalidCursor
+}
+
+// sortFields lists the fields movies can be sorted by.
+var sortFields = map[string]bool{
+	"title":        true,
+	"rating":       true,
+	"release_date": true,
 }
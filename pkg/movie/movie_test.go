@@ -2,7 +2,9 @@ package movie_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -10,17 +12,23 @@ import (
 	"testing"
 	"time"
 
+	"github.com/axywe/filmotheka_vk/internal/middleware"
+	"github.com/axywe/filmotheka_vk/pkg/actor"
 	movie "github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/storage/sqlstore"
 	testutils "github.com/axywe/filmotheka_vk/testutils"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	_ "github.com/lib/pq"
 )
 
+var ctx = context.Background()
+
 func TestCreateMovie(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := movie.NewHandler(db)
+	h := movie.NewHandler(store)
 
 	film := movie.Movie{
 		Title:       "Test Movie",
@@ -55,13 +63,30 @@ func TestCreateMovie(t *testing.T) {
 	if m.Title != film.Title {
 		t.Errorf("Expected movie title to be '%s', got '%s'", film.Title, m.Title)
 	}
+
+	// Unlike a replacement, creating a movie does not require a release date.
+	req, err = http.NewRequest("POST", "/movies", strings.NewReader(`{"title": "Undated Movie"}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code without a release date: got %v want %v", status, http.StatusCreated)
+	}
 }
 
 func TestGetMovies(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := movie.NewHandler(db)
+	h := movie.NewHandler(store)
+
+	testutils.CreateMovie(t, store, movie.Movie{
+		Title:       "Listed Movie",
+		Description: "A movie to be listed",
+		ReleaseDate: time.Now(),
+		Rating:      5.0,
+	})
 
 	req, err := http.NewRequest("GET", "/movies", nil)
 	if err != nil {
@@ -100,13 +125,19 @@ func TestGetMovies(t *testing.T) {
 }
 
 func TestUpdateMovie(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := movie.NewHandler(db)
+	h := movie.NewHandler(store)
+
+	movieID := testutils.CreateMovie(t, store, movie.Movie{
+		Title:       "Test Movie",
+		Description: "A test movie description",
+		ReleaseDate: time.Now(),
+		Rating:      5.0,
+	})
 
 	updatedMovie := movie.Movie{
-		ID:          1,
+		ID:          movieID,
 		Title:       "Updated Test Movie",
 		Description: "An updated test movie description",
 		ReleaseDate: time.Now(),
@@ -171,10 +202,9 @@ func createMovie(t *testing.T, h *movie.Handler, newMovie movie.Movie) (int, err
 }
 
 func TestDeleteMovieEnsuringDeletion(t *testing.T) {
-	db := testutils.SetupDB(t)
-	defer db.Close()
+	store := testutils.SetupStore(t)
 
-	h := movie.NewHandler(db)
+	h := movie.NewHandler(store)
 
 	newMovie := movie.Movie{
 		Title:       "Test Movie for Deletion",
@@ -205,9 +235,427 @@ func TestDeleteMovieEnsuringDeletion(t *testing.T) {
 		t.Errorf("Unexpected response body: got %v want %v", responseBody, expectedResponseBody)
 	}
 
-	var movieCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM movies WHERE id = $1", createdMovieID).Scan(&movieCount)
-	if err != nil || movieCount != 0 {
+	if _, err := store.GetMovie(ctx, createdMovieID); !errors.Is(err, storage.ErrNotFound) {
 		t.Errorf("Movie was not deleted: %v", err)
 	}
 }
+
+func TestCreateMovieWithCast(t *testing.T) {
+	store := testutils.SetupStore(t)
+
+	h := movie.NewHandler(store)
+
+	a, err := store.CreateActor(ctx, actor.Actor{Name: "Cast Member", Gender: "Female", Birthdate: time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Failed to insert actor: %v", err)
+	}
+	actorID := a.ID
+
+	film := movie.Movie{
+		Title:       "Movie With Cast",
+		Description: "A movie with a cast",
+		ReleaseDate: time.Now(),
+		Rating:      7.0,
+		Actors:      []movie.ActorBrief{{ID: actorID}, {ID: actorID + 1000000}},
+	}
+
+	b, err := json.Marshal(film)
+	if err != nil {
+		t.Fatalf("Failed to marshal movie: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/movies", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	film.Actors = []movie.ActorBrief{{ID: actorID}}
+	b, err = json.Marshal(film)
+	if err != nil {
+		t.Fatalf("Failed to marshal movie: %v", err)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, "/movies", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var m movie.Movie
+	if err := json.NewDecoder(rr.Body).Decode(&m); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	if len(m.Actors) != 1 || m.Actors[0].Name != "Cast Member" {
+		t.Errorf("Expected cast to contain 'Cast Member', got %v", m.Actors)
+	}
+
+	stored, err := store.GetMovie(ctx, m.ID)
+	if err != nil || len(stored.Actors) != 1 {
+		t.Errorf("The movie is not associated with the actor: %v", err)
+	}
+}
+
+func TestSearchMoviesByActor(t *testing.T) {
+	store := testutils.SetupStore(t)
+
+	h := movie.NewHandler(store)
+
+	a, err := store.CreateActor(ctx, actor.Actor{Name: "Searchable Performer", Gender: "Male", Birthdate: time.Date(1975, time.May, 5, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Failed to insert actor: %v", err)
+	}
+	actorID := a.ID
+
+	testutils.CreateMovie(t, store, movie.Movie{
+		Title:       "Untitled Feature",
+		Description: "A movie found through its cast",
+		ReleaseDate: time.Now(),
+		Rating:      6.0,
+		Actors:      []movie.ActorBrief{{ID: actorID}},
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "/movies?actor=able%20perf", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var movies []movie.Movie
+	if err := json.NewDecoder(rr.Body).Decode(&movies); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	if len(movies) == 0 {
+		t.Fatalf("Expected at least one movie, got 0")
+	}
+	for _, m := range movies {
+		if m.Match == nil || m.Match.Title || m.Match.Actor == "" {
+			t.Errorf("Expected an actor match for movie %d, got %+v", m.ID, m.Match)
+		}
+	}
+}
+
+func TestSearchMoviesIsInjectionSafe(t *testing.T) {
+	store := testutils.SetupStore(t)
+
+	h := movie.NewHandler(store)
+
+	req, err := http.NewRequest(http.MethodGet, "/movies?search=%27%20OR%201%3D1%20--", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, "/movies?search=%25&sortBy=title%3B%20DROP%20TABLE%20movies", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestGetMoviesPaginated(t *testing.T) {
+	store := testutils.SetupStore(t)
+
+	h := movie.NewHandler(store)
+
+	for i := 0; i < 2; i++ {
+		testutils.CreateMovie(t, store, movie.Movie{
+			Title:       fmt.Sprintf("Paginated Movie %d", i),
+			Description: "A movie listed page by page",
+			ReleaseDate: time.Now(),
+			Rating:      4.0,
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/movies?search=Paginated&limit=1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var movies []movie.Movie
+	if err := json.NewDecoder(rr.Body).Decode(&movies); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	if len(movies) != 1 {
+		t.Errorf("Expected exactly one movie, got %d", len(movies))
+	}
+	if rr.Header().Get("X-Total-Count") == "" {
+		t.Errorf("Expected X-Total-Count header to be set")
+	}
+	if !strings.Contains(rr.Header().Get("Link"), `rel="next"`) {
+		t.Errorf("Expected a link to the next page, got %q", rr.Header().Get("Link"))
+	}
+
+	req, err = http.NewRequest(http.MethodGet, "/movies?limit=1&cursor=broken", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestMovieItemRoutes(t *testing.T) {
+	store := testutils.SetupStore(t)
+
+	h := movie.NewHandler(store)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/movies/{id}", h.ServeItem)
+
+	createdMovieID := testutils.CreateMovie(t, store, movie.Movie{
+		Title:       "Movie Addressed By ID",
+		Description: "A movie fetched through its own path",
+		ReleaseDate: time.Now(),
+		Rating:      6.5,
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{"Get", http.MethodGet, fmt.Sprintf("/movies/%d", createdMovieID), "", http.StatusOK},
+		{"GetMissing", http.MethodGet, fmt.Sprintf("/movies/%d", createdMovieID+1000000), "", http.StatusNotFound},
+		{"GetInvalidID", http.MethodGet, "/movies/abc", "", http.StatusBadRequest},
+		{"PutMismatchedID", http.MethodPut, fmt.Sprintf("/movies/%d", createdMovieID), fmt.Sprintf(`{"id": %d, "title": "Other"}`, createdMovieID+1), http.StatusBadRequest},
+		{"PutWithoutReleaseDate", http.MethodPut, fmt.Sprintf("/movies/%d", createdMovieID), `{"title": "Movie Renamed By ID", "rating": 6}`, http.StatusBadRequest},
+		{"Put", http.MethodPut, fmt.Sprintf("/movies/%d", createdMovieID), `{"title": "Movie Renamed By ID", "releaseDate": "2020-01-01T00:00:00Z", "rating": 6}`, http.StatusOK},
+		{"Delete", http.MethodDelete, fmt.Sprintf("/movies/%d", createdMovieID), "", http.StatusOK},
+		{"GetDeleted", http.MethodGet, fmt.Sprintf("/movies/%d", createdMovieID), "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", test.name, status, test.expectedStatus)
+		}
+	}
+}
+
+func TestPatchMovie(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	releaseDate := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, title, description, release_date, rating FROM movies WHERE id = \\$1 FOR UPDATE").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "release_date", "rating"}).
+			AddRow(7, "Old Title", "Old description", releaseDate, 8.5))
+	mock.ExpectQuery("UPDATE movies SET").
+		WithArgs(7, "Old Title", "", releaseDate, 0.0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "release_date", "rating"}).
+			AddRow(7, "Old Title", "", releaseDate, 0.0))
+	mock.ExpectQuery("SELECT am.movie_id, a.id, a.name FROM actor_movie am").
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id", "id", "name"}))
+	mock.ExpectCommit()
+
+	h := movie.NewHandler(sqlstore.New(db, sqlstore.Postgres))
+
+	req, err := http.NewRequest(http.MethodPatch, "/movies/7", strings.NewReader(`{"description": null, "rating": 0}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.SetPathValue("id", "7")
+	rr := httptest.NewRecorder()
+	h.ServeItem(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body.String())
+	}
+
+	var m movie.Movie
+	if err := json.NewDecoder(rr.Body).Decode(&m); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	if m.Title != "Old Title" || m.Description != "" || m.Rating != 0 {
+		t.Errorf("Unexpected movie after patch: %+v", m)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPatchMovieErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, title, description, release_date, rating FROM movies WHERE id = \\$1 FOR UPDATE").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "release_date", "rating"}))
+	mock.ExpectRollback()
+
+	h := movie.NewHandler(sqlstore.New(db, sqlstore.Postgres))
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"Missing", `{"title": "New Title"}`, http.StatusNotFound},
+		{"MismatchedID", `{"id": 8}`, http.StatusBadRequest},
+		{"Malformed", `{"title": `, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodPatch, "/movies/7", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.SetPathValue("id", "7")
+		rr := httptest.NewRecorder()
+		h.ServeItem(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", test.name, status, test.expectedStatus)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMoviePatchApply(t *testing.T) {
+	m := movie.Movie{Title: "Title", Description: "Description", Rating: 5, Actors: []movie.ActorBrief{{ID: 1}}}
+
+	var patch movie.MoviePatch
+	if err := json.Unmarshal([]byte(`{"description": null, "actors": null}`), &patch); err != nil {
+		t.Fatalf("Could not decode patch: %v", err)
+	}
+	if err := patch.Apply(&m); err != nil {
+		t.Fatalf("Unexpected error applying patch: %v", err)
+	}
+	if m.Title != "Title" || m.Description != "" || m.Rating != 5 || m.Actors == nil || len(m.Actors) != 0 {
+		t.Errorf("Unexpected movie after patch: %+v", m)
+	}
+
+	patch = movie.MoviePatch{}
+	if err := json.Unmarshal([]byte(`{"title": null}`), &patch); err != nil {
+		t.Fatalf("Could not decode patch: %v", err)
+	}
+	if err := patch.Apply(&m); err == nil {
+		t.Errorf("Expected an error when clearing the title")
+	}
+}
+
+// stubStore answers GetMovie from a map and leaves the rest of
+// movie.MovieStore unimplemented.
+type stubStore struct {
+	movie.MovieStore
+	movies map[int]movie.Movie
+}
+
+func (s stubStore) GetMovie(ctx context.Context, id int) (movie.Movie, error) {
+	m, ok := s.movies[id]
+	if !ok {
+		return m, storage.ErrNotFound
+	}
+	return m, nil
+}
+
+func TestGetMovieFromStore(t *testing.T) {
+	h := movie.NewHandler(stubStore{movies: map[int]movie.Movie{7: {ID: 7, Title: "Stub"}}})
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/movies/7", http.StatusOK},
+		{"/movies/8", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.SetPathValue("id", strings.TrimPrefix(test.path, "/movies/"))
+		rr := httptest.NewRecorder()
+
+		h.ServeItem(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", test.path, status, test.expectedStatus)
+		}
+	}
+}
+
+// slowStore holds GetMovie until the request context is done, like a query
+// that outlives its deadline.
+type slowStore struct {
+	movie.MovieStore
+}
+
+func (slowStore) GetMovie(ctx context.Context, id int) (movie.Movie, error) {
+	<-ctx.Done()
+	return movie.Movie{}, ctx.Err()
+}
+
+func TestGetMovieTimesOut(t *testing.T) {
+	h := middleware.Deadline(10*time.Millisecond, http.HandlerFunc(movie.NewHandler(slowStore{}).ServeItem))
+
+	req := httptest.NewRequest(http.MethodGet, "/movies/7", nil)
+	req.SetPathValue("id", "7")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusGatewayTimeout {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusGatewayTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = httptest.NewRequest(http.MethodGet, "/movies/7", nil).WithContext(ctx)
+	req.SetPathValue("id", "7")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code for a canceled request: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+}
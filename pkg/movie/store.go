@@ -0,0 +1,62 @@
+package movie
+
+import (
+	"context"
+
+	"github.com/axywe/filmotheka_vk/pkg/query"
+)
+
+// MovieStore persists movies and their casts. Implementations report a
+// missing movie with storage.ErrNotFound and rejected input with a
+// *storage.InvalidError.
+type MovieStore interface {
+	// ListMovies returns one page of the movies selected by q, each with its
+	// cast.
+	ListMovies(ctx context.Context, q MovieQuery) (MovieList, error)
+	// GetMovie returns the movie with the given ID and its cast.
+	GetMovie(ctx context.Context, id int) (Movie, error)
+	// CreateMovie stores a new movie and links it to its cast. Every actor of
+	// the cast must exist. The returned movie carries its ID and actor names.
+	CreateMovie(ctx context.Context, m Movie) (Movie, error)
+	// SaveMovie overwrites every member of an existing movie and replaces its
+	// cast when m.Actors is not nil. It returns the movie as persisted.
+	SaveMovie(ctx context.Context, m Movie) (Movie, error)
+	// UpdateMovie loads the movie with the given ID without its cast, passes
+	// it to update and saves the result like SaveMovie, as one unit of work.
+	// An error returned by update aborts the operation.
+	UpdateMovie(ctx context.Context, id int, update func(m *Movie) error) (Movie, error)
+	// DeleteMovie removes a movie and its links to actors.
+	DeleteMovie(ctx context.Context, id int) error
+}
+
+// MovieQuery selects the movies returned by ListMovies.
+type MovieQuery struct {
+	// Title, Actor and Any are fragments matched against the title, the
+	// names of the cast or both. Empty fragments are ignored.
+	Title string
+	Actor string
+	Any   string
+
+	SortBy string
+	Desc   bool
+
+	Page query.Page
+	// SeekValue is the sort value decoded from Page.Cursor, if any.
+	SeekValue interface{}
+}
+
+// Searching reports whether q filters movies by any fragment. Movies
+// returned for such a query carry a SearchMatch.
+func (q MovieQuery) Searching() bool {
+	return q.Title != "" || q.Actor != "" || q.Any != ""
+}
+
+// MovieList is a page of movies together with the total number of movies
+// selected by the query.
+type MovieList struct {
+	Movies []Movie
+	Total  int
+	// More reports whether there are more movies past the page, in the
+	// direction the page was read.
+	More bool
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// DefaultLimit is the page size used when a cursor is given without a limit.
+	DefaultLimit = 20
+	// MaxLimit is the largest page a client may request.
+	MaxLimit = 100
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Cursor marks a position in a keyset-paginated listing: the sort key and
+// direction it was issued for, the sort value and ID of the boundary row, and
+// whether the page lies before or after that row.
+type Cursor struct {
+	SortBy string          `json:"s"`
+	Desc   bool            `json:"d,omitempty"`
+	Value  json.RawMessage `json:"v,omitempty"`
+	ID     int             `json:"i"`
+	Before bool            `json:"b,omitempty"`
+}
+
+// NewCursor returns a cursor positioned at the row identified by value and id.
+func NewCursor(sortBy string, desc bool, value interface{}, id int, before bool) (Cursor, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return Cursor{}, err
+	}
+	return Cursor{SortBy: sortBy, Desc: desc, Value: raw, ID: id, Before: before}, nil
+}
+
+// Encode returns the opaque form of the cursor handed out to clients.
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a cursor previously produced by Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Page holds the pagination parameters of a listing request. A zero Limit
+// means the whole listing is returned.
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor *Cursor
+	// Offsets is set when the client paginates with offset instead of cursors.
+	Offsets bool
+}
+
+// ParsePage reads the limit, offset and cursor query parameters.
+func ParsePage(values url.Values) (Page, error) {
+	var p Page
+	if s := values.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return p, errors.New("Limit must be a number between 1 and " + strconv.Itoa(MaxLimit))
+		}
+		p.Limit = limit
+	}
+	if s := values.Get("offset"); s != "" {
+		offset, err := strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return p, errors.New("Offset must be a non-negative number")
+		}
+		p.Offset = offset
+		p.Offsets = true
+	}
+	if s := values.Get("cursor"); s != "" {
+		if p.Offsets {
+			return p, errors.New("Cursor and offset cannot be combined")
+		}
+		c, err := DecodeCursor(s)
+		if err != nil {
+			return p, err
+		}
+		p.Cursor = &c
+		if p.Limit == 0 {
+			p.Limit = DefaultLimit
+		}
+	}
+	return p, nil
+}
+
+// Seek restricts the listing to the rows after the cursor position, or before
+// it for a backward cursor, under an ordering by column and then idColumn in
+// the cursor's direction. value is the decoded sort value of the cursor.
+func (b *Builder) Seek(c Cursor, column, idColumn string, value interface{}) *Builder {
+	op := ">"
+	if c.Desc != c.Before {
+		op = "<"
+	}
+	if column == idColumn {
+		return b.Where(idColumn + " " + op + " " + b.Arg(c.ID))
+	}
+	return b.Where("(" + column + ", " + idColumn + ") " + op + " (" + b.Arg(value) + ", " + b.Arg(c.ID) + ")")
+}
+
+// Backward reports whether the page is read backwards from its cursor, in
+// which case the listing must be queried in reverse order and flipped.
+func (p Page) Backward() bool {
+	return p.Cursor != nil && p.Cursor.Before
+}
+
+// Neighbours returns the query parameters of the pages next to the current
+// one, or nil where there is no such page. more tells whether rows beyond the
+// page limit were found in the reading direction; first and last are cursors
+// positioned before the first and after the last row of the page.
+func (p Page) Neighbours(total int, more bool, first, last *Cursor) (next, prev url.Values) {
+	if p.Limit == 0 {
+		return nil, nil
+	}
+	limit := strconv.Itoa(p.Limit)
+
+	if p.Offsets {
+		if p.Offset+p.Limit < total {
+			next = url.Values{"limit": {limit}, "offset": {strconv.Itoa(p.Offset + p.Limit)}}
+		}
+		if p.Offset > 0 {
+			offset := p.Offset - p.Limit
+			if offset < 0 {
+				offset = 0
+			}
+			prev = url.Values{"limit": {limit}, "offset": {strconv.Itoa(offset)}}
+		}
+		return next, prev
+	}
+
+	if first == nil || last == nil {
+		return nil, nil
+	}
+	hasNext, hasPrev := more, p.Cursor != nil
+	if p.Backward() {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		next = url.Values{"limit": {limit}, "cursor": {last.Encode()}}
+	}
+	if hasPrev {
+		prev = url.Values{"limit": {limit}, "cursor": {first.Encode()}}
+	}
+	return next, prev
+}
@@ -0,0 +1,86 @@
+package query_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePage(t *testing.T) {
+	page, err := query.ParsePage(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, query.Page{}, page)
+
+	page, err = query.ParsePage(url.Values{"limit": {"10"}, "offset": {"30"}})
+	require.NoError(t, err)
+	assert.Equal(t, query.Page{Limit: 10, Offset: 30, Offsets: true}, page)
+
+	cursor := query.Cursor{SortBy: "id", ID: 42}
+	page, err = query.ParsePage(url.Values{"cursor": {cursor.Encode()}})
+	require.NoError(t, err)
+	assert.Equal(t, query.DefaultLimit, page.Limit)
+	assert.Equal(t, 42, page.Cursor.ID)
+
+	for _, values := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"1000"}},
+		{"limit": {"ten"}},
+		{"offset": {"-1"}},
+		{"cursor": {"not a cursor"}},
+		{"cursor": {cursor.Encode()}, "offset": {"0"}},
+	} {
+		_, err := query.ParsePage(values)
+		assert.Error(t, err, values.Encode())
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor, err := query.NewCursor("title", true, "Heat", 7, true)
+	require.NoError(t, err)
+
+	decoded, err := query.DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+}
+
+func TestSeek(t *testing.T) {
+	b := query.New()
+	b.Seek(query.Cursor{SortBy: "rating", Desc: true, ID: 3}, "rating", "id", 7.5)
+	statement, args := b.Build("SELECT id FROM movies")
+	assert.Equal(t, "SELECT id FROM movies WHERE (rating, id) < ($1, $2)", statement)
+	assert.Equal(t, []interface{}{7.5, 3}, args)
+
+	b = query.New()
+	b.Seek(query.Cursor{SortBy: "id", ID: 3, Before: true}, "id", "id", 3)
+	statement, args = b.Build("SELECT id FROM actors")
+	assert.Equal(t, "SELECT id FROM actors WHERE id < $1", statement)
+	assert.Equal(t, []interface{}{3}, args)
+}
+
+func TestNeighbours(t *testing.T) {
+	first := &query.Cursor{SortBy: "id", ID: 11, Before: true}
+	last := &query.Cursor{SortBy: "id", ID: 20}
+
+	next, prev := query.Page{}.Neighbours(100, false, first, last)
+	assert.Nil(t, next)
+	assert.Nil(t, prev)
+
+	next, prev = query.Page{Limit: 10, Offset: 5, Offsets: true}.Neighbours(100, true, first, last)
+	assert.Equal(t, "15", next.Get("offset"))
+	assert.Equal(t, "0", prev.Get("offset"))
+
+	next, prev = query.Page{Limit: 10, Offset: 90, Offsets: true}.Neighbours(100, false, first, last)
+	assert.Nil(t, next)
+	assert.Equal(t, "80", prev.Get("offset"))
+
+	next, prev = query.Page{Limit: 10}.Neighbours(100, true, first, last)
+	assert.Equal(t, last.Encode(), next.Get("cursor"))
+	assert.Nil(t, prev)
+
+	next, prev = query.Page{Limit: 10, Cursor: first}.Neighbours(100, false, first, last)
+	assert.Equal(t, last.Encode(), next.Get("cursor"))
+	assert.Nil(t, prev)
+}
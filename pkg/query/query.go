@@ -0,0 +1,148 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Columns whitelists the sort keys a listing accepts and maps each of them to
+// the SQL expression it stands for. Keys not present here are never spliced
+// into a statement.
+type Columns map[string]string
+
+// Dialect spells the conditions that differ between database engines.
+type Dialect interface {
+	// Match returns a case-insensitive condition matching expr against the
+	// LIKE pattern bound to placeholder. Wildcards in the pattern are escaped
+	// with a backslash.
+	Match(expr, placeholder string) string
+	// Unlimited returns the clause standing in for LIMIT when an OFFSET is
+	// given without one, or "" if the engine accepts OFFSET on its own.
+	Unlimited() string
+}
+
+// Builder assembles a SELECT statement from trusted SQL fragments. Values
+// coming from a request only ever reach the database as bind parameters.
+type Builder struct {
+	dialect Dialect
+	where   []string
+	orderBy []string
+	limit   string
+	offset  string
+	args    []interface{}
+}
+
+// New returns a builder emitting PostgreSQL.
+func New() *Builder {
+	return &Builder{}
+}
+
+// NewFor returns a builder emitting the given dialect.
+func NewFor(d Dialect) *Builder {
+	return &Builder{dialect: d}
+}
+
+// Arg registers a bind parameter and returns its placeholder.
+func (b *Builder) Arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// Args returns the bind parameters registered so far, in placeholder order.
+func (b *Builder) Args() []interface{} {
+	return b.args
+}
+
+// Where adds a condition to the WHERE clause. Conditions are joined with AND.
+// The condition must be a trusted fragment; user input goes through Arg.
+func (b *Builder) Where(condition string) *Builder {
+	b.where = append(b.where, condition)
+	return b
+}
+
+// Match returns a case-insensitive condition matching expr against the LIKE
+// pattern bound to placeholder.
+func (b *Builder) Match(expr, placeholder string) string {
+	if b.dialect != nil {
+		return b.dialect.Match(expr, placeholder)
+	}
+	return fmt.Sprintf("%s ILIKE %s", expr, placeholder)
+}
+
+// Contains returns a case-insensitive condition matching rows where expr
+// contains fragment literally. LIKE wildcards in fragment are escaped.
+func (b *Builder) Contains(expr, fragment string) string {
+	return b.Match(expr, b.Arg(ContainsPattern(fragment)))
+}
+
+// OrderBy appends the column registered under key to the ORDER BY clause.
+// It reports false and leaves the builder untouched when key is unknown.
+func (b *Builder) OrderBy(columns Columns, key string, desc bool) bool {
+	column, ok := columns[key]
+	if !ok {
+		return false
+	}
+	b.ThenBy(column, desc)
+	return true
+}
+
+// ThenBy appends a trusted expression to the ORDER BY clause, typically a
+// unique column that makes the ordering total.
+func (b *Builder) ThenBy(expr string, desc bool) *Builder {
+	if desc {
+		b.orderBy = append(b.orderBy, expr+" DESC")
+	} else {
+		b.orderBy = append(b.orderBy, expr+" ASC")
+	}
+	return b
+}
+
+func (b *Builder) Limit(n int) *Builder {
+	b.limit = b.Arg(n)
+	return b
+}
+
+func (b *Builder) Offset(n int) *Builder {
+	b.offset = b.Arg(n)
+	return b
+}
+
+// Build appends the collected clauses to base and returns the statement
+// together with its bind parameters. The builder may be extended afterwards,
+// which lets a listing build its count query before adding paging clauses.
+func (b *Builder) Build(base string) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString(base)
+	if len(b.where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(b.where, " AND "))
+	}
+	if len(b.orderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(b.orderBy, ", "))
+	}
+	if b.limit != "" {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(b.limit)
+	} else if b.offset != "" && b.dialect != nil {
+		sb.WriteString(b.dialect.Unlimited())
+	}
+	if b.offset != "" {
+		sb.WriteString(" OFFSET ")
+		sb.WriteString(b.offset)
+	}
+	return sb.String(), append([]interface{}(nil), b.args...)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes the LIKE wildcards in s so that it matches literally.
+// Backslash is the default escape character in PostgreSQL.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// ContainsPattern returns a LIKE pattern matching any text containing s.
+func ContainsPattern(s string) string {
+	return "%" + EscapeLike(s) + "%"
+}
@@ -0,0 +1,48 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"50%", `50\%`},
+		{"snake_case", `snake\_case`},
+		{`back\slash`, `back\\slash`},
+		{"'; DROP TABLE movies; --", "'; DROP TABLE movies; --"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, query.EscapeLike(test.input))
+	}
+	assert.Equal(t, `%50\%%`, query.ContainsPattern("50%"))
+}
+
+func TestBuilder(t *testing.T) {
+	columns := query.Columns{"title": "title", "rating": "rating"}
+
+	b := query.New()
+	b.Where(b.Contains("title", "O'Brien%"))
+	assert.True(t, b.OrderBy(columns, "rating", true))
+	assert.False(t, b.OrderBy(columns, "rating; DROP TABLE movies", false))
+	b.Limit(10).Offset(20)
+
+	statement, args := b.Build("SELECT id FROM movies")
+
+	assert.Equal(t, "SELECT id FROM movies WHERE title ILIKE $1 ORDER BY rating DESC LIMIT $2 OFFSET $3", statement)
+	assert.Equal(t, []interface{}{`%O'Brien\%%`, 10, 20}, args)
+}
+
+func TestBuilderWithoutClauses(t *testing.T) {
+	statement, args := query.New().Build("SELECT id FROM actors")
+
+	assert.Equal(t, "SELECT id FROM actors", statement)
+	assert.Empty(t, args)
+}
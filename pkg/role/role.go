@@ -0,0 +1,288 @@
+package role
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/util"
+)
+
+// Definition is the name and the permissions of a role, as sent to create or
+// replace it.
+type Definition struct {
+	Name        string            `json:"name"`
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+type Handler struct {
+	store RoleStore
+}
+
+func NewHandler(store RoleStore) *Handler {
+	return &Handler{store: store}
+}
+
+// validate checks d and returns it as a role with its permissions
+// deduplicated and sorted, as the stores return them.
+func (d Definition) validate() (auth.Role, error) {
+	if n := len([]rune(d.Name)); n < 1 || n > 50 {
+		return auth.Role{}, storage.Invalid("Role name must be between 1 and 50 characters")
+	}
+	if strings.IndexFunc(d.Name, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) }) >= 0 {
+		return auth.Role{}, storage.Invalid("Role name cannot contain spaces or control characters")
+	}
+	r := auth.Role{Name: d.Name, Permissions: []auth.Permission{}}
+	granted := make(map[auth.Permission]bool, len(d.Permissions))
+	for _, p := range d.Permissions {
+		if !auth.KnownPermission(p) {
+			return auth.Role{}, storage.Invalid(fmt.Sprintf("Unknown permission %q", p))
+		}
+		if !granted[p] {
+			granted[p] = true
+			r.Permissions = append(r.Permissions, p)
+		}
+	}
+	sort.Slice(r.Permissions, func(i, j int) bool { return r.Permissions[i] < r.Permissions[j] })
+	return r, nil
+}
+
+// sendError responds to a failed operation with the matching status code.
+func sendError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *storage.InvalidError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		util.SendJSONError(w, r, "Role not found", http.StatusNotFound)
+	case errors.As(err, &invalid):
+		util.SendJSONError(w, r, invalid.Message, http.StatusBadRequest)
+	case errors.Is(err, storage.ErrConflict):
+		util.SendJSONError(w, r, "Role name already taken", http.StatusConflict)
+	case errors.Is(err, auth.ErrBeyondOwn):
+		util.SendJSONError(w, r, "Cannot grant permissions beyond your own", http.StatusForbidden)
+	default:
+		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// @Summary List the permissions
+// @Description Returns every permission a role can grant.
+// @Security ApiKeyAuth
+// @Tags Roles
+// @Produce json
+// @Success 200 {array} string "Permissions"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Router /roles/permissions [get]
+func (h *Handler) Permissions(w http.ResponseWriter, r *http.Request) {
+	util.SendJSONResponse(w, r, auth.Permissions, http.StatusOK)
+}
+
+// @Summary Get list of roles
+// @Security ApiKeyAuth
+// @Tags Roles
+// @Produce json
+// @Success 200 {array} auth.Role "Roles with their permissions"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /roles [get]
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.store.ListRoles(r.Context())
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, roles, http.StatusOK)
+}
+
+// @Summary Get a role
+// @Security ApiKeyAuth
+// @Tags Roles
+// @Produce json
+// @Param id path int true "Role ID"
+// @Success 200 {object} auth.Role "Role with its permissions"
+// @Failure 400 {object} util.ErrorResponse "Invalid role ID"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 404 {object} util.ErrorResponse "Role not found"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /roles/{id} [get]
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.store.GetRole(r.Context(), id)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, role, http.StatusOK)
+}
+
+// @Summary Create a role
+// @Description Creates a role granting the given permissions, see /roles/permissions. The role cannot grant
+// @Description permissions beyond those of the caller.
+// @Security ApiKeyAuth
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param role body Definition true "Name and permissions"
+// @Success 201 {object} auth.Role "Role created"
+// @Failure 400 {object} util.ErrorResponse "Invalid input data"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action or permissions beyond your own"
+// @Failure 409 {object} util.ErrorResponse "Role name already taken"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /roles [post]
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+
+	var d Definition
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	role, err := d.validate()
+	if err == nil {
+		err = auth.CheckWithinOwn(r.Context(), h.store, claims.Role, role)
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	created, err := h.store.CreateRole(r.Context(), role)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, created, http.StatusCreated)
+}
+
+// @Summary Replace a role
+// @Description Replaces the name and the permissions of a role. The accounts with the role are granted the new
+// @Description permissions on their next request. The admin role and the caller's own role cannot be changed,
+// @Description and neither the old nor the new permissions can go beyond those of the caller.
+// @Security ApiKeyAuth
+// @Tags Roles
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param role body Definition true "Name and permissions"
+// @Success 200 {object} auth.Role "Role as stored"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action or permissions beyond your own"
+// @Failure 404 {object} util.ErrorResponse "Role not found"
+// @Failure 409 {object} util.ErrorResponse "Role name already taken"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /roles/{id} [put]
+func (h *Handler) Replace(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if id == auth.RoleAdmin {
+		util.SendJSONError(w, r, "The admin role cannot be changed", http.StatusBadRequest)
+		return
+	}
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+	if id == claims.Role {
+		util.SendJSONError(w, r, "Accounts cannot change their own role", http.StatusBadRequest)
+		return
+	}
+
+	var d Definition
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	role, err := d.validate()
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	role.ID = id
+	// Neither taking permissions the caller lacks away from a role nor
+	// granting them to it is within the caller's reach.
+	current, err := h.store.GetRole(r.Context(), id)
+	if err == nil {
+		err = auth.CheckWithinOwn(r.Context(), h.store, claims.Role, current)
+	}
+	if err == nil {
+		err = auth.CheckWithinOwn(r.Context(), h.store, claims.Role, role)
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	saved, err := h.store.SaveRole(r.Context(), role)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, saved, http.StatusOK)
+}
+
+// @Summary Delete a role
+// @Description Deletes a role no account has, along with the invites to it. The admin and viewer roles
+// @Description cannot be deleted, nor can roles with permissions beyond those of the caller.
+// @Security ApiKeyAuth
+// @Tags Roles
+// @Param id path int true "Role ID"
+// @Success 200 {string} string "Role deleted"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action or permissions beyond your own"
+// @Failure 404 {object} util.ErrorResponse "Role not found"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /roles/{id} [delete]
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if id == auth.RoleAdmin || id == auth.RoleViewer {
+		util.SendJSONError(w, r, "The admin and viewer roles cannot be deleted", http.StatusBadRequest)
+		return
+	}
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+
+	current, err := h.store.GetRole(r.Context(), id)
+	if err == nil {
+		err = auth.CheckWithinOwn(r.Context(), h.store, claims.Role, current)
+	}
+	if err == nil {
+		err = h.store.DeleteRole(r.Context(), id)
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, "Role deleted", http.StatusOK)
+}
@@ -0,0 +1,183 @@
+package role_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/role"
+	"github.com/axywe/filmotheka_vk/pkg/storage/memory"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ctx = context.Background()
+
+// serve sends a request with body to h as an administrator, with the path
+// value id unless it is zero, and decodes the response into out if it is not
+// nil.
+func serve(t *testing.T, h http.HandlerFunc, method string, id int, body interface{}, out interface{}) int {
+	t.Helper()
+	return serveAs(t, h, method, id, body, auth.RoleAdmin, out)
+}
+
+// serveAs is serve for an account with the given role.
+func serveAs(t *testing.T, h http.HandlerFunc, method string, id int, body interface{}, roleID int, out interface{}) int {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Unable to marshal body: %v", err)
+	}
+	req := httptest.NewRequest(method, "/roles", bytes.NewReader(raw))
+	if id != 0 {
+		req.SetPathValue("id", strconv.Itoa(id))
+	}
+	claims := &tokens.Claims{Role: roleID, RegisteredClaims: jwt.RegisteredClaims{Subject: "1"}}
+	req = req.WithContext(tokens.NewContext(req.Context(), claims))
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	if out != nil {
+		if err := json.Unmarshal(rr.Body.Bytes(), out); err != nil {
+			t.Fatalf("Unable to unmarshal response %q: %v", rr.Body.String(), err)
+		}
+	}
+	return rr.Code
+}
+
+func TestCreateAndReplaceRole(t *testing.T) {
+	h := role.NewHandler(memory.New())
+
+	var created auth.Role
+	def := role.Definition{Name: "critic", Permissions: []auth.Permission{auth.MoviesWrite, auth.MoviesRead, auth.MoviesRead}}
+	if status := serve(t, h.Create, http.MethodPost, 0, def, &created); status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v", status)
+	}
+	if created.ID == 0 || created.Name != "critic" || len(created.Permissions) != 2 || created.Permissions[0] != auth.MoviesRead {
+		t.Errorf("Expected the permissions deduplicated and sorted, got %+v", created)
+	}
+
+	var replaced auth.Role
+	def = role.Definition{Name: "reviewer", Permissions: []auth.Permission{auth.ActorsRead}}
+	if status := serve(t, h.Replace, http.MethodPut, created.ID, def, &replaced); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", status)
+	}
+	var stored auth.Role
+	serve(t, h.Get, http.MethodGet, created.ID, nil, &stored)
+	if stored.Name != "reviewer" || len(stored.Permissions) != 1 || stored.Permissions[0] != auth.ActorsRead {
+		t.Errorf("Expected the replaced role, got %+v", stored)
+	}
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		id             int
+		definition     role.Definition
+		expectedStatus int
+	}{
+		{"TakenName", h.Create, 0, role.Definition{Name: "viewer"}, http.StatusConflict},
+		{"EmptyName", h.Create, 0, role.Definition{}, http.StatusBadRequest},
+		{"NameWithSpace", h.Create, 0, role.Definition{Name: "movie critic"}, http.StatusBadRequest},
+		{"UnknownPermission", h.Create, 0, role.Definition{Name: "root", Permissions: []auth.Permission{"everything"}}, http.StatusBadRequest},
+		{"ReplaceAdmin", h.Replace, auth.RoleAdmin, role.Definition{Name: "admin"}, http.StatusBadRequest},
+		{"ReplaceUnknown", h.Replace, 99, role.Definition{Name: "ghost"}, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := serve(t, test.handler, http.MethodPost, test.id, test.definition, nil); status != test.expectedStatus {
+				t.Errorf("Expected status %v, got %v", test.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestRoleBeyondOwn(t *testing.T) {
+	store := memory.New()
+	h := role.NewHandler(store)
+	const editor, moderator = 3, 4
+	manager, err := store.CreateRole(ctx, auth.Role{Name: "manager", Permissions: []auth.Permission{
+		auth.MoviesRead, auth.MoviesWrite, auth.ActorsRead, auth.ActorsWrite, auth.RolesRead, auth.RolesWrite,
+	}})
+	if err != nil {
+		t.Fatalf("Unable to create role: %v", err)
+	}
+
+	everything := role.Definition{Name: "manager", Permissions: auth.Permissions}
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		id             int
+		definition     role.Definition
+		expectedStatus int
+	}{
+		{"CreateBeyondOwn", h.Create, 0, role.Definition{Name: "root", Permissions: []auth.Permission{auth.UsersWrite}}, http.StatusForbidden},
+		{"ReplaceOwn", h.Replace, manager.ID, everything, http.StatusBadRequest},
+		{"ReplaceBeyondOwn", h.Replace, editor, role.Definition{Name: "editor", Permissions: []auth.Permission{auth.UsersWrite}}, http.StatusForbidden},
+		{"ReplaceRoleBeyondOwn", h.Replace, moderator, role.Definition{Name: "moderator"}, http.StatusForbidden},
+		{"CreateWithinOwn", h.Create, 0, role.Definition{Name: "critic", Permissions: []auth.Permission{auth.MoviesWrite}}, http.StatusCreated},
+		{"ReplaceWithinOwn", h.Replace, editor, role.Definition{Name: "editor", Permissions: []auth.Permission{auth.MoviesRead}}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := serveAs(t, test.handler, http.MethodPost, test.id, test.definition, manager.ID, nil); status != test.expectedStatus {
+				t.Errorf("Expected status %v, got %v", test.expectedStatus, status)
+			}
+		})
+	}
+
+	if stored, _ := store.GetRole(ctx, manager.ID); stored.Can(auth.UsersWrite) {
+		t.Errorf("The manager role granted itself users:write: %+v", stored)
+	}
+
+	if status := serveAs(t, h.Delete, http.MethodDelete, moderator, nil, manager.ID, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 deleting a role beyond the own one, got %v", status)
+	}
+	if _, err := store.GetRole(ctx, moderator); err != nil {
+		t.Errorf("The moderator role was deleted: %v", err)
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	store := memory.New()
+	h := role.NewHandler(store)
+	const editor = 3
+	editorAccount, err := store.AddUser(ctx, auth.User{Username: "editor", Password: "hash", Role: editor})
+	if err != nil {
+		t.Fatalf("Unable to add account: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		id             int
+		expectedStatus int
+	}{
+		{"Admin", auth.RoleAdmin, http.StatusBadRequest},
+		{"Viewer", auth.RoleViewer, http.StatusBadRequest},
+		{"Assigned", editor, http.StatusBadRequest},
+		{"Unknown", 99, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := serve(t, h.Delete, http.MethodDelete, test.id, nil, nil); status != test.expectedStatus {
+				t.Errorf("Expected status %v, got %v", test.expectedStatus, status)
+			}
+		})
+	}
+
+	store.UpdateUser(ctx, editorAccount.ID, func(u *auth.User) error {
+		u.Role = auth.RoleViewer
+		return nil
+	})
+	if status := serve(t, h.Delete, http.MethodDelete, editor, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", status)
+	}
+	var roles []auth.Role
+	serve(t, h.List, http.MethodGet, 0, nil, &roles)
+	if len(roles) != 3 {
+		t.Errorf("Expected 3 roles left, got %+v", roles)
+	}
+}
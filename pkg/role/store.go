@@ -0,0 +1,23 @@
+package role
+
+import (
+	"context"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+)
+
+// RoleStore persists the roles and their permissions. Implementations report
+// a missing role with storage.ErrNotFound, a taken name with
+// storage.ErrConflict and rejected input with a *storage.InvalidError.
+type RoleStore interface {
+	auth.RoleStore
+	// ListRoles returns every role ordered by ID.
+	ListRoles(ctx context.Context) ([]auth.Role, error)
+	// CreateRole stores a new role and returns it with its ID.
+	CreateRole(ctx context.Context, r auth.Role) (auth.Role, error)
+	// SaveRole replaces the name and the permissions of an existing role.
+	SaveRole(ctx context.Context, r auth.Role) (auth.Role, error)
+	// DeleteRole removes a role together with the invites to it. A
+	// role that accounts still have is rejected.
+	DeleteRole(ctx context.Context, id int) error
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var errNotChecked = errors.New("Database has not been checked yet")
+
+// Monitor pings a database in the background and remembers the outcome, so
+// that liveness and readiness checks do not have to reach the database.
+type Monitor struct {
+	db       *sql.DB
+	interval time.Duration
+
+	mu  sync.RWMutex
+	err error
+}
+
+// NewMonitor returns a monitor pinging db every interval once it runs.
+func NewMonitor(db *sql.DB, interval time.Duration) *Monitor {
+	return &Monitor{db: db, interval: interval, err: errNotChecked}
+}
+
+// Run checks the database right away and then every interval until ctx is
+// done. Changes of the database state are logged.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+	err := m.db.PingContext(ctx)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	m.mu.Lock()
+	prev := m.err
+	m.err = err
+	m.mu.Unlock()
+
+	switch {
+	case err != nil && prev == nil:
+		slog.Error("database became unreachable", "error", err)
+	case err == nil && prev != nil && prev != errNotChecked:
+		slog.Info("database is reachable again")
+	}
+}
+
+// Err returns the error of the latest check, nil if the database answered.
+func (m *Monitor) Err() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/axywe/filmotheka_vk/pkg/actor"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+func (s *Store) ListActors(ctx context.Context, q actor.ActorQuery) (actor.ActorList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := actor.ActorList{Actors: []actor.Actor{}, Total: len(s.actors)}
+	if list.Total == 0 {
+		return list, nil
+	}
+
+	page := q.Page
+	actors := []actor.Actor{}
+	for _, a := range s.actors {
+		if c := page.Cursor; c != nil && (c.Before && a.ID >= c.ID || !c.Before && a.ID <= c.ID) {
+			continue
+		}
+		actors = append(actors, a)
+	}
+	sort.Slice(actors, func(i, j int) bool {
+		return (actors[i].ID < actors[j].ID) != page.Backward()
+	})
+
+	actors = window(actors, page.Offset, page.Limit, &list.More)
+	if page.Backward() {
+		for i, j := 0, len(actors)-1; i < j; i, j = i+1, j-1 {
+			actors[i], actors[j] = actors[j], actors[i]
+		}
+	}
+	for i := range actors {
+		actors[i].Movies = s.filmography(actors[i].ID)
+	}
+	list.Actors = append(list.Actors, actors...)
+	return list, nil
+}
+
+func (s *Store) GetActor(ctx context.Context, id int) (actor.Actor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.actors[id]
+	if !ok {
+		return actor.Actor{}, storage.ErrNotFound
+	}
+	a.Movies = s.filmography(id)
+	return a, nil
+}
+
+func (s *Store) CreateActor(ctx context.Context, a actor.Actor) (actor.Actor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkFilmography(a.Movies); err != nil {
+		return a, err
+	}
+	s.lastActorID++
+	a.ID = s.lastActorID
+	s.actors[a.ID] = storedActor(a)
+	for _, m := range a.Movies {
+		s.link(a.ID, m.ID)
+	}
+	a.Movies = s.filmography(a.ID)
+	return a, nil
+}
+
+func (s *Store) SaveActor(ctx context.Context, a actor.Actor) (actor.Actor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveActor(a)
+}
+
+func (s *Store) UpdateActor(ctx context.Context, id int, update func(a *actor.Actor) error) (actor.Actor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.actors[id]
+	if !ok {
+		return actor.Actor{}, storage.ErrNotFound
+	}
+	if err := update(&a); err != nil {
+		return actor.Actor{}, err
+	}
+	return s.saveActor(a)
+}
+
+func (s *Store) DeleteActor(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.actors[id]; !ok {
+		return storage.ErrNotFound
+	}
+	s.unlinkActor(id)
+	delete(s.actors, id)
+	return nil
+}
+
+// saveActor overwrites a stored actor and replaces their filmography when
+// a.Movies is not nil. The caller holds the write lock.
+func (s *Store) saveActor(a actor.Actor) (actor.Actor, error) {
+	if _, ok := s.actors[a.ID]; !ok {
+		return actor.Actor{}, storage.ErrNotFound
+	}
+	if err := s.checkFilmography(a.Movies); err != nil {
+		return actor.Actor{}, err
+	}
+
+	s.actors[a.ID] = storedActor(a)
+	if a.Movies != nil {
+		s.unlinkActor(a.ID)
+		for _, m := range a.Movies {
+			s.link(a.ID, m.ID)
+		}
+	}
+
+	saved := s.actors[a.ID]
+	saved.Movies = s.filmography(a.ID)
+	return saved, nil
+}
+
+// checkFilmography fails like a foreign key violation when a movie does not
+// exist.
+func (s *Store) checkFilmography(movies []actor.MovieBrief) error {
+	for _, m := range movies {
+		if _, ok := s.movies[m.ID]; !ok {
+			return storage.Invalid("Foreign key constraint violation")
+		}
+	}
+	return nil
+}
+
+// filmography returns the movies of an actor ordered by ID, or nil when they
+// have none.
+func (s *Store) filmography(actorID int) []actor.MovieBrief {
+	var movies []actor.MovieBrief
+	for _, id := range sortedIDs(s.filmographies[actorID]) {
+		movies = append(movies, actor.MovieBrief{ID: id, Title: s.movies[id].Title})
+	}
+	return movies
+}
+
+// storedActor returns a as the actors table would hold it.
+func storedActor(a actor.Actor) actor.Actor {
+	return actor.Actor{
+		ID:        a.ID,
+		Name:      a.Name,
+		Gender:    a.Gender,
+		Birthdate: date(a.Birthdate),
+	}
+}
@@ -0,0 +1,155 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/actor"
+	"github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func TestSearchMovies(t *testing.T) {
+	s := memory.New()
+	a, err := s.CreateActor(ctx, actor.Actor{Name: "Jane Roe", Birthdate: time.Now()})
+	require.NoError(t, err)
+	_, err = s.CreateMovie(ctx, movie.Movie{Title: "Roe Story", ReleaseDate: time.Now(), Rating: 5})
+	require.NoError(t, err)
+	_, err = s.CreateMovie(ctx, movie.Movie{Title: "Other", ReleaseDate: time.Now(), Rating: 6, Actors: []movie.ActorBrief{{ID: a.ID}}})
+	require.NoError(t, err)
+	_, err = s.CreateMovie(ctx, movie.Movie{Title: "Unrelated", ReleaseDate: time.Now(), Rating: 7})
+	require.NoError(t, err)
+
+	list, err := s.ListMovies(ctx, movie.MovieQuery{Any: "ROE", SortBy: "title"})
+	require.NoError(t, err)
+	require.Equal(t, 2, list.Total)
+	assert.Equal(t, "Other", list.Movies[0].Title)
+	assert.Equal(t, &movie.SearchMatch{Actor: "Jane Roe"}, list.Movies[0].Match)
+	assert.Equal(t, &movie.SearchMatch{Title: true}, list.Movies[1].Match)
+
+	list, err = s.ListMovies(ctx, movie.MovieQuery{Title: "%", SortBy: "rating"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, list.Total)
+}
+
+func TestListMoviesWithCursors(t *testing.T) {
+	s := memory.New()
+	for i := 0; i < 5; i++ {
+		_, err := s.CreateMovie(ctx, movie.Movie{Title: fmt.Sprintf("Movie %d", i), ReleaseDate: time.Now(), Rating: float64(i % 2)})
+		require.NoError(t, err)
+	}
+
+	q := movie.MovieQuery{SortBy: "rating", Desc: true, Page: query.Page{Limit: 2}}
+	first, err := s.ListMovies(ctx, q)
+	require.NoError(t, err)
+	assert.True(t, first.More)
+	assert.Equal(t, []int{4, 2}, ids(first.Movies))
+
+	last := first.Movies[1]
+	q.Page.Cursor = &query.Cursor{SortBy: "rating", Desc: true, ID: last.ID}
+	q.SeekValue = last.Rating
+	second, err := s.ListMovies(ctx, q)
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 3}, ids(second.Movies))
+
+	back := second.Movies[0]
+	q.Page.Cursor = &query.Cursor{SortBy: "rating", Desc: true, ID: back.ID, Before: true}
+	q.SeekValue = back.Rating
+	previous, err := s.ListMovies(ctx, q)
+	require.NoError(t, err)
+	assert.False(t, previous.More)
+	assert.Equal(t, []int{4, 2}, ids(previous.Movies))
+}
+
+func TestDeleteCascades(t *testing.T) {
+	s := memory.New()
+	a, err := s.CreateActor(ctx, actor.Actor{Name: "Jane Roe", Birthdate: time.Now()})
+	require.NoError(t, err)
+	m, err := s.CreateMovie(ctx, movie.Movie{Title: "Roe Story", ReleaseDate: time.Now(), Actors: []movie.ActorBrief{{ID: a.ID}}})
+	require.NoError(t, err)
+
+	require.NoError(t, s.DeleteActor(ctx, a.ID))
+	m, err = s.GetMovie(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Empty(t, m.Actors)
+	assert.ErrorIs(t, s.DeleteActor(ctx, a.ID), storage.ErrNotFound)
+}
+
+func TestRejectedWritesChangeNothing(t *testing.T) {
+	s := memory.New()
+	m, err := s.CreateMovie(ctx, movie.Movie{Title: "Roe Story", ReleaseDate: time.Now()})
+	require.NoError(t, err)
+
+	_, err = s.CreateActor(ctx, actor.Actor{Name: "Jane Roe", Movies: []actor.MovieBrief{{ID: m.ID}, {ID: m.ID + 1}}})
+	var invalid *storage.InvalidError
+	assert.True(t, errors.As(err, &invalid))
+
+	_, err = s.UpdateMovie(ctx, m.ID, func(m *movie.Movie) error {
+		m.Title = "Renamed"
+		m.Actors = []movie.ActorBrief{{ID: 42}}
+		return nil
+	})
+	assert.True(t, errors.As(err, &invalid))
+
+	m, err = s.GetMovie(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Roe Story", m.Title)
+	list, err := s.ListActors(ctx, actor.ActorQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, list.Total)
+}
+
+func TestUsernamesAreUnique(t *testing.T) {
+	s := memory.New()
+	_, err := s.AddUser(ctx, auth.User{Username: "admin", Role: 1})
+	require.NoError(t, err)
+	_, err = s.AddUser(ctx, auth.User{Username: "admin", Role: 2})
+	assert.ErrorIs(t, err, storage.ErrConflict)
+
+	u, err := s.GetUserByUsername(ctx, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, 1, u.Role)
+	_, err = s.GetUserByUsername(ctx, "nobody")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	s := memory.New()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a, err := s.CreateActor(ctx, actor.Actor{Name: "Actor", Birthdate: time.Now()})
+			assert.NoError(t, err)
+			_, err = s.CreateMovie(ctx, movie.Movie{Title: "Movie", ReleaseDate: time.Now(), Actors: []movie.ActorBrief{{ID: a.ID}}})
+			assert.NoError(t, err)
+			_, err = s.ListMovies(ctx, movie.MovieQuery{Actor: "act", SortBy: "title"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	list, err := s.ListActors(ctx, actor.ActorQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, 50, list.Total)
+}
+
+func ids(movies []movie.Movie) []int {
+	result := []int{}
+	for _, m := range movies {
+		result = append(result, m.ID)
+	}
+	return result
+}
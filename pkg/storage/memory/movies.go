@@ -0,0 +1,271 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+func (s *Store) ListMovies(ctx context.Context, q movie.MovieQuery) (movie.MovieList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	movies := []movie.Movie{}
+	for _, m := range s.movies {
+		titleMatch := false
+		actorMatch := ""
+		if q.Any != "" {
+			titleMatch = contains(m.Title, q.Any)
+			actorMatch = s.matchedActor(m.ID, q.Any)
+			if !titleMatch && actorMatch == "" {
+				continue
+			}
+		} else {
+			if q.Title != "" {
+				if titleMatch = contains(m.Title, q.Title); !titleMatch {
+					continue
+				}
+			}
+			if q.Actor != "" {
+				if actorMatch = s.matchedActor(m.ID, q.Actor); actorMatch == "" {
+					continue
+				}
+			}
+		}
+		if q.Searching() {
+			m.Match = &movie.SearchMatch{Title: titleMatch, Actor: actorMatch}
+		}
+		movies = append(movies, m)
+	}
+	list := movie.MovieList{Movies: []movie.Movie{}, Total: len(movies)}
+	if list.Total == 0 {
+		return list, nil
+	}
+
+	// Walk the listing in reading order: reversed for a backward page, whose
+	// rows are flipped back before returning.
+	page := q.Page
+	reverse := q.Desc != page.Backward()
+	order := func(c int) int {
+		if reverse {
+			return -c
+		}
+		return c
+	}
+	sort.Slice(movies, func(i, j int) bool {
+		return order(compareMovie(movies[i], q.SortBy, sortValue(movies[j], q.SortBy), movies[j].ID)) < 0
+	})
+	if page.Cursor != nil {
+		after := movies[:0]
+		for _, m := range movies {
+			if order(compareMovie(m, q.SortBy, q.SeekValue, page.Cursor.ID)) > 0 {
+				after = append(after, m)
+			}
+		}
+		movies = after
+	}
+
+	movies = window(movies, page.Offset, page.Limit, &list.More)
+	if page.Backward() {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+	for i := range movies {
+		movies[i].Actors = s.cast(movies[i].ID)
+	}
+	list.Movies = append(list.Movies, movies...)
+	return list, nil
+}
+
+func (s *Store) GetMovie(ctx context.Context, id int) (movie.Movie, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.movies[id]
+	if !ok {
+		return movie.Movie{}, storage.ErrNotFound
+	}
+	m.Actors = s.cast(id)
+	return m, nil
+}
+
+func (s *Store) CreateMovie(ctx context.Context, m movie.Movie) (movie.Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCast(m.Actors); err != nil {
+		return m, err
+	}
+	s.lastMovieID++
+	m.ID = s.lastMovieID
+	s.movies[m.ID] = stored(m)
+	if len(m.Actors) == 0 {
+		return m, nil
+	}
+
+	for _, a := range m.Actors {
+		s.link(a.ID, m.ID)
+	}
+	m.Actors = s.cast(m.ID)
+	return m, nil
+}
+
+func (s *Store) SaveMovie(ctx context.Context, m movie.Movie) (movie.Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveMovie(m)
+}
+
+func (s *Store) UpdateMovie(ctx context.Context, id int, update func(m *movie.Movie) error) (movie.Movie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.movies[id]
+	if !ok {
+		return movie.Movie{}, storage.ErrNotFound
+	}
+	if err := update(&m); err != nil {
+		return movie.Movie{}, err
+	}
+	return s.saveMovie(m)
+}
+
+func (s *Store) DeleteMovie(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[id]; !ok {
+		return storage.ErrNotFound
+	}
+	s.unlinkMovie(id)
+	delete(s.movies, id)
+	return nil
+}
+
+// saveMovie overwrites a stored movie and replaces its cast when m.Actors is
+// not nil. The caller holds the write lock.
+func (s *Store) saveMovie(m movie.Movie) (movie.Movie, error) {
+	if _, ok := s.movies[m.ID]; !ok {
+		return movie.Movie{}, storage.ErrNotFound
+	}
+	if err := s.checkCast(m.Actors); err != nil {
+		return movie.Movie{}, err
+	}
+
+	s.movies[m.ID] = stored(m)
+	if m.Actors != nil {
+		s.unlinkMovie(m.ID)
+		for _, a := range m.Actors {
+			s.link(a.ID, m.ID)
+		}
+	}
+
+	saved := s.movies[m.ID]
+	saved.Actors = s.cast(m.ID)
+	return saved, nil
+}
+
+// checkCast fails with a *storage.InvalidError naming the actors of cast that
+// do not exist.
+func (s *Store) checkCast(cast []movie.ActorBrief) error {
+	missing := []string{}
+	seen := make(map[int]bool)
+	for _, a := range cast {
+		if _, ok := s.actors[a.ID]; !ok && !seen[a.ID] {
+			missing = append(missing, strconv.Itoa(a.ID))
+		}
+		seen[a.ID] = true
+	}
+	if len(missing) > 0 {
+		return storage.Invalid("Actors not found: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// cast returns the cast of a movie ordered by name, or nil when it has none.
+func (s *Store) cast(movieID int) []movie.ActorBrief {
+	var cast []movie.ActorBrief
+	for _, id := range sortedIDs(s.casts[movieID]) {
+		cast = append(cast, movie.ActorBrief{ID: id, Name: s.actors[id].Name})
+	}
+	sort.SliceStable(cast, func(i, j int) bool {
+		return cast[i].Name < cast[j].Name
+	})
+	return cast
+}
+
+// matchedActor returns the first cast member of a movie, by name, whose name
+// contains fragment.
+func (s *Store) matchedActor(movieID int, fragment string) string {
+	for _, a := range s.cast(movieID) {
+		if contains(a.Name, fragment) {
+			return a.Name
+		}
+	}
+	return ""
+}
+
+// stored returns m as the movies table would hold it.
+func stored(m movie.Movie) movie.Movie {
+	return movie.Movie{
+		ID:          m.ID,
+		Title:       m.Title,
+		Description: m.Description,
+		ReleaseDate: date(m.ReleaseDate),
+		Rating:      rating(m.Rating),
+	}
+}
+
+func sortValue(m movie.Movie, sortBy string) interface{} {
+	switch sortBy {
+	case "title":
+		return m.Title
+	case "release_date":
+		return m.ReleaseDate
+	default:
+		return m.Rating
+	}
+}
+
+// compareMovie compares m with the position given by a sort value and an ID,
+// in ascending order.
+func compareMovie(m movie.Movie, sortBy string, value interface{}, id int) int {
+	var c int
+	switch sortBy {
+	case "title":
+		title, _ := value.(string)
+		c = strings.Compare(m.Title, title)
+	case "release_date":
+		releaseDate, _ := value.(time.Time)
+		c = m.ReleaseDate.Compare(releaseDate)
+	default:
+		r, _ := value.(float64)
+		c = cmp.Compare(m.Rating, r)
+	}
+	if c == 0 {
+		c = cmp.Compare(m.ID, id)
+	}
+	return c
+}
+
+// window applies an offset and a limit to rows, reporting in more whether
+// rows past the limit were cut off. A zero limit keeps every row.
+func window[T any](rows []T, offset, limit int, more *bool) []T {
+	if offset >= len(rows) {
+		return rows[:0]
+	}
+	rows = rows[offset:]
+	*more = limit > 0 && len(rows) > limit
+	if *more {
+		rows = rows[:limit]
+	}
+	return rows
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+// defaultRoles are the roles created by migration 0004.
+var defaultRoles = []auth.Role{
+	{ID: auth.RoleAdmin, Name: "admin", Permissions: sorted(auth.Permissions...)},
+	{ID: auth.RoleViewer, Name: "viewer", Permissions: sorted(auth.MoviesRead, auth.ActorsRead)},
+	{ID: 3, Name: "editor", Permissions: sorted(auth.MoviesRead, auth.MoviesWrite, auth.ActorsRead, auth.ActorsWrite)},
+	{ID: 4, Name: "moderator", Permissions: sorted(
+		auth.MoviesRead, auth.MoviesWrite, auth.MoviesDelete,
+		auth.ActorsRead, auth.ActorsWrite, auth.ActorsDelete,
+		auth.UsersRead, auth.UsersInvite,
+	)},
+}
+
+// sorted returns the permissions in the order the SQL store returns them.
+func sorted(permissions ...auth.Permission) []auth.Permission {
+	permissions = append([]auth.Permission{}, permissions...)
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return permissions
+}
+
+// copyRole returns r with its own copy of the permissions, so that callers
+// cannot change the stored role.
+func copyRole(r auth.Role) auth.Role {
+	r.Permissions = append([]auth.Permission{}, r.Permissions...)
+	return r
+}
+
+func (s *Store) GetRole(ctx context.Context, id int) (auth.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.roles[id]
+	if !ok {
+		return auth.Role{}, storage.ErrNotFound
+	}
+	return copyRole(r), nil
+}
+
+func (s *Store) ListRoles(ctx context.Context) ([]auth.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]auth.Role, 0, len(s.roles))
+	for _, r := range s.roles {
+		roles = append(roles, copyRole(r))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles, nil
+}
+
+func (s *Store) CreateRole(ctx context.Context, r auth.Role) (auth.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.roleNameTaken(r) {
+		return auth.Role{}, storage.ErrConflict
+	}
+	s.lastRoleID++
+	r.ID = s.lastRoleID
+	r = copyRole(r)
+	s.roles[r.ID] = r
+	return copyRole(r), nil
+}
+
+func (s *Store) SaveRole(ctx context.Context, r auth.Role) (auth.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[r.ID]; !ok {
+		return auth.Role{}, storage.ErrNotFound
+	}
+	if s.roleNameTaken(r) {
+		return auth.Role{}, storage.ErrConflict
+	}
+	r = copyRole(r)
+	s.roles[r.ID] = r
+	return copyRole(r), nil
+}
+
+func (s *Store) DeleteRole(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Role == id {
+			return storage.Invalid("Role is still assigned to accounts")
+		}
+	}
+	if _, ok := s.roles[id]; !ok {
+		return storage.ErrNotFound
+	}
+	for hash, i := range s.invites {
+		if i.Role == id {
+			delete(s.invites, hash)
+		}
+	}
+	delete(s.roles, id)
+	return nil
+}
+
+// roleNameTaken reports whether another role than r is named like r.
+func (s *Store) roleNameTaken(r auth.Role) bool {
+	for _, existing := range s.roles {
+		if existing.ID != r.ID && existing.Name == r.Name {
+			return true
+		}
+	}
+	return false
+}
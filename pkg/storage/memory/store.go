@@ -0,0 +1,130 @@
+// Package memory implements the movie, actor, user and role stores in
+// process memory. It follows the semantics of the SQL store and is meant for
+// local development and hermetic tests; its contents are lost when the
+// process exits.
+package memory
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/actor"
+	"github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/role"
+	"github.com/axywe/filmotheka_vk/pkg/user"
+)
+
+// Store implements movie.MovieStore, actor.ActorStore, auth.Store,
+// user.UserStore and role.RoleStore. It is safe for concurrent use. Its
+// operations never wait on I/O, so they ignore their context.
+type Store struct {
+	mu sync.RWMutex
+
+	// movies and actors hold the rows without their casts and filmographies,
+	// which are kept in casts and filmographies, both indexes of the same
+	// actor/movie links.
+	movies        map[int]movie.Movie
+	actors        map[int]actor.Actor
+	casts         map[int]map[int]bool
+	filmographies map[int]map[int]bool
+	users         map[int]auth.User
+	// refreshTokens is keyed by hash, revokedTokens maps the jti of the
+	// revoked access tokens to their expiry.
+	refreshTokens map[string]auth.RefreshToken
+	revokedTokens map[string]time.Time
+	// invites is keyed by the hash of their codes.
+	invites map[string]invite
+	roles   map[int]auth.Role
+
+	lastMovieID int
+	lastActorID int
+	lastUserID  int
+	lastRoleID  int
+}
+
+// New returns an empty store with the roles created by migration 0004.
+func New() *Store {
+	s := &Store{
+		movies:        make(map[int]movie.Movie),
+		actors:        make(map[int]actor.Actor),
+		casts:         make(map[int]map[int]bool),
+		filmographies: make(map[int]map[int]bool),
+		users:         make(map[int]auth.User),
+		refreshTokens: make(map[string]auth.RefreshToken),
+		revokedTokens: make(map[string]time.Time),
+		invites:       make(map[string]invite),
+		roles:         make(map[int]auth.Role),
+	}
+	for _, r := range defaultRoles {
+		s.roles[r.ID] = r
+		s.lastRoleID = r.ID
+	}
+	return s
+}
+
+var (
+	_ movie.MovieStore = (*Store)(nil)
+	_ actor.ActorStore = (*Store)(nil)
+	_ auth.Store       = (*Store)(nil)
+	_ user.UserStore   = (*Store)(nil)
+	_ role.RoleStore   = (*Store)(nil)
+)
+
+// link records that an actor plays in a movie. Linking twice is a no-op, like
+// the primary key of actor_movie.
+func (s *Store) link(actorID, movieID int) {
+	if s.casts[movieID] == nil {
+		s.casts[movieID] = make(map[int]bool)
+	}
+	if s.filmographies[actorID] == nil {
+		s.filmographies[actorID] = make(map[int]bool)
+	}
+	s.casts[movieID][actorID] = true
+	s.filmographies[actorID][movieID] = true
+}
+
+// unlinkMovie removes every link of a movie.
+func (s *Store) unlinkMovie(movieID int) {
+	for actorID := range s.casts[movieID] {
+		delete(s.filmographies[actorID], movieID)
+	}
+	delete(s.casts, movieID)
+}
+
+// unlinkActor removes every link of an actor.
+func (s *Store) unlinkActor(actorID int) {
+	for movieID := range s.filmographies[actorID] {
+		delete(s.casts[movieID], actorID)
+	}
+	delete(s.filmographies, actorID)
+}
+
+// sortedIDs returns the keys of set in ascending order.
+func sortedIDs(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// date drops the time of day like a DATE column does.
+func date(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// rating rounds r to one decimal like a DECIMAL(3, 1) column does.
+func rating(r float64) float64 {
+	return math.Round(r*10) / 10
+}
+
+// contains matches a fragment case-insensitively like ILIKE '%fragment%'.
+func contains(s, fragment string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(fragment))
+}
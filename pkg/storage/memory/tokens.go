@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+// SaveRefreshToken stores t and drops the refresh tokens that have expired.
+func (s *Store) SaveRefreshToken(ctx context.Context, t auth.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, existing := range s.refreshTokens {
+		if existing.ExpiresAt.Before(now) {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	if _, ok := s.users[t.UserID]; !ok {
+		return storage.Invalid("Foreign key constraint violation")
+	}
+	s.refreshTokens[t.Hash] = t
+	return nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, hash string) (auth.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.refreshTokens[hash]
+	if !ok {
+		return t, storage.ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *Store) UseRefreshToken(ctx context.Context, hash string) (auth.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refreshTokens[hash]
+	if !ok {
+		return t, storage.ErrNotFound
+	}
+	used := t
+	used.Used = true
+	s.refreshTokens[hash] = used
+	return t, nil
+}
+
+func (s *Store) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, t := range s.refreshTokens {
+		if t.FamilyID == familyID {
+			t.Revoked = true
+			s.refreshTokens[hash] = t
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken adds jti to the denylist and drops the entries that have
+// expired.
+func (s *Store) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for revoked, exp := range s.revokedTokens {
+		if exp.Before(now) {
+			delete(s.revokedTokens, revoked)
+		}
+	}
+	s.revokedTokens[jti] = expiresAt
+	return nil
+}
+
+func (s *Store) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.revokedTokens[jti]
+	return ok, nil
+}
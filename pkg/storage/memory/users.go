@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/user"
+)
+
+// invite is a stored invite and whether it was used to register.
+type invite struct {
+	user.Invite
+	used bool
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (auth.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return auth.User{}, storage.ErrNotFound
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id int) (auth.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return auth.User{}, storage.ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *Store) ListUsers(ctx context.Context, q user.UserQuery) (user.UserList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := user.UserList{Users: []auth.User{}, Total: len(s.users)}
+	if list.Total == 0 {
+		return list, nil
+	}
+
+	page := q.Page
+	users := []auth.User{}
+	for _, u := range s.users {
+		if c := page.Cursor; c != nil && (c.Before && u.ID >= c.ID || !c.Before && u.ID <= c.ID) {
+			continue
+		}
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return (users[i].ID < users[j].ID) != page.Backward()
+	})
+
+	users = window(users, page.Offset, page.Limit, &list.More)
+	if page.Backward() {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	list.Users = append(list.Users, users...)
+	return list, nil
+}
+
+// AddUser stores a new account and returns it with its ID. Usernames are
+// unique; adding a taken one fails with storage.ErrConflict.
+func (s *Store) AddUser(ctx context.Context, u auth.User) (auth.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addUser(u)
+}
+
+func (s *Store) addUser(u auth.User) (auth.User, error) {
+	for _, existing := range s.users {
+		if existing.Username == u.Username {
+			return auth.User{}, storage.ErrConflict
+		}
+	}
+	s.lastUserID++
+	u.ID = s.lastUserID
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, u auth.User, hash string) (auth.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hash == "" {
+		return s.addUser(u)
+	}
+	i, ok := s.invites[hash]
+	if !ok || i.used || !time.Now().Before(i.ExpiresAt) {
+		return auth.User{}, storage.Invalid("Invalid or expired invite code")
+	}
+	u.Role = i.Role
+	created, err := s.addUser(u)
+	if err != nil {
+		return auth.User{}, err
+	}
+	i.used = true
+	s.invites[hash] = i
+	return created, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id int, update func(u *auth.User) error) (auth.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return auth.User{}, storage.ErrNotFound
+	}
+	if err := update(&u); err != nil {
+		return auth.User{}, err
+	}
+	for _, existing := range s.users {
+		if existing.ID != id && existing.Username == u.Username {
+			return auth.User{}, storage.ErrConflict
+		}
+	}
+	s.users[id] = u
+	return u, nil
+}
+
+func (s *Store) RevokeUserTokens(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, t := range s.refreshTokens {
+		if t.UserID == userID {
+			t.Revoked = true
+			s.refreshTokens[hash] = t
+		}
+	}
+	return nil
+}
+
+// SaveInvite stores i and drops the invites that have expired.
+func (s *Store) SaveInvite(ctx context.Context, i user.Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, existing := range s.invites {
+		if existing.ExpiresAt.Before(now) {
+			delete(s.invites, hash)
+		}
+	}
+	if _, ok := s.users[i.CreatedBy]; !ok {
+		return storage.Invalid("Foreign key constraint violation")
+	}
+	s.invites[i.Hash] = invite{Invite: i}
+	return nil
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Engine names the database engine a migration set is written for.
+type Engine string
+
+const (
+	Postgres Engine = "postgres"
+	SQLite   Engine = "sqlite"
+)
+
+// migrations holds one directory of numbered migrations per engine. Each
+// migration is a pair of files, NNNN_name.up.sql and NNNN_name.down.sql.
+//
+//go:embed migrations
+var migrations embed.FS
+
+//go:embed seed.sql
+var seed string
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations returns the migrations of engine ordered by version.
+func Migrations(engine Engine) ([]Migration, error) {
+	dir := path.Join("migrations", string(engine))
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for engine %q", engine)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		prefix, rest, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with a version number", name)
+		}
+		content, err := fs.ReadFile(migrations, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: strings.TrimSuffix(rest, "."+direction+".sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s lacks its up or down file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Migrate applies the pending migrations of engine in order and records each
+// of them in schema_migrations. Every migration runs in its own transaction.
+func Migrate(ctx context.Context, db *sql.DB, engine Engine) error {
+	list, err := Migrations(engine)
+	if err != nil {
+		return err
+	}
+	if err := createMigrationsTable(ctx, db); err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		err := WithTx(ctx, db, func(tx *sql.Tx) error {
+			applied, err := lockMigrations(ctx, tx, engine, m.Version)
+			if err != nil || applied {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the latest steps applied migrations of engine, newest
+// first.
+func MigrateDown(ctx context.Context, db *sql.DB, engine Engine, steps int) error {
+	list, err := Migrations(engine)
+	if err != nil {
+		return err
+	}
+	if err := createMigrationsTable(ctx, db); err != nil {
+		return err
+	}
+
+	for i := len(list) - 1; i >= 0 && steps > 0; i-- {
+		m := list[i]
+		reverted := false
+		err := WithTx(ctx, db, func(tx *sql.Tx) error {
+			applied, err := lockMigrations(ctx, tx, engine, m.Version)
+			if err != nil || !applied {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+			reverted = err == nil
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if reverted {
+			steps--
+		}
+	}
+	return nil
+}
+
+// PendingMigrations returns the number of migrations of engine that have not
+// been applied to db. It only reads: a database without schema_migrations
+// has every migration pending.
+func PendingMigrations(ctx context.Context, db *sql.DB, engine Engine) (int, error) {
+	pending, _, err := compareMigrations(ctx, db, engine)
+	return pending, err
+}
+
+// CheckMigrations returns an error unless the migrations applied to db are
+// exactly those of engine, so that neither an outdated schema nor one
+// migrated by a newer binary passes.
+func CheckMigrations(ctx context.Context, db *sql.DB, engine Engine) error {
+	pending, unknown, err := compareMigrations(ctx, db, engine)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migration(s) pending", pending)
+	}
+	if unknown > 0 {
+		return fmt.Errorf("%d migration(s) applied that this binary does not know", unknown)
+	}
+	return nil
+}
+
+// compareMigrations returns the number of migrations of engine missing from
+// db and the number of versions applied to db that engine has no migration
+// for.
+func compareMigrations(ctx context.Context, db *sql.DB, engine Engine) (pending, unknown int, err error) {
+	list, err := Migrations(engine)
+	if err != nil {
+		return 0, 0, err
+	}
+	applied, err := appliedVersions(ctx, db, engine)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, m := range list {
+		if applied[m.Version] {
+			delete(applied, m.Version)
+		} else {
+			pending++
+		}
+	}
+	return pending, len(applied), nil
+}
+
+// appliedVersions returns the versions recorded in schema_migrations, none if
+// the table does not exist yet.
+func appliedVersions(ctx context.Context, db *sql.DB, engine Engine) (map[int]bool, error) {
+	exists := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if engine == SQLite {
+		exists = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	}
+	var found bool
+	if err := db.QueryRowContext(ctx, exists).Scan(&found); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]bool)
+	if !found {
+		return applied, nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Seed creates the demo accounts admin/admin and user/user unless they exist.
+func Seed(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, seed)
+	return err
+}
+
+func createMigrationsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	return err
+}
+
+// lockMigrations keeps concurrent instances from migrating at the same time
+// and reports whether version is already applied. SQLite transactions opened
+// by OpenSQLite hold the database lock already.
+func lockMigrations(ctx context.Context, tx *sql.Tx, engine Engine, version int) (bool, error) {
+	if engine == Postgres {
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE schema_migrations IN EXCLUSIVE MODE"); err != nil {
+			return false, err
+		}
+	}
+	applied := 0
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = $1", version).Scan(&applied)
+	return applied > 0, err
+}
@@ -0,0 +1,77 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func TestMigrationsMatchAcrossEngines(t *testing.T) {
+	postgres, err := storage.Migrations(storage.Postgres)
+	require.NoError(t, err)
+	sqlite, err := storage.Migrations(storage.SQLite)
+	require.NoError(t, err)
+
+	require.Len(t, sqlite, len(postgres))
+	for i := range postgres {
+		assert.Equal(t, i+1, postgres[i].Version)
+		assert.Equal(t, postgres[i].Version, sqlite[i].Version)
+		assert.Equal(t, postgres[i].Name, sqlite[i].Name)
+	}
+
+	_, err = storage.Migrations("oracle")
+	assert.Error(t, err)
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "filmotheka.db"), false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	all, err := storage.Migrations(storage.SQLite)
+	require.NoError(t, err)
+	pending, err := storage.PendingMigrations(ctx, db, storage.SQLite)
+	require.NoError(t, err)
+	assert.Equal(t, len(all), pending)
+
+	assert.ErrorContains(t, storage.CheckMigrations(ctx, db, storage.SQLite), "pending")
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'").Scan(&tables))
+	assert.Equal(t, 0, tables, "checking the migrations creates no table")
+
+	require.NoError(t, storage.Migrate(ctx, db, storage.SQLite))
+	require.NoError(t, storage.Migrate(ctx, db, storage.SQLite), "applied migrations are skipped")
+	assert.NoError(t, storage.CheckMigrations(ctx, db, storage.SQLite))
+	pending, err = storage.PendingMigrations(ctx, db, storage.SQLite)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pending)
+
+	_, err = db.Exec("INSERT INTO schema_migrations (version) VALUES (9999)")
+	require.NoError(t, err)
+	assert.ErrorContains(t, storage.CheckMigrations(ctx, db, storage.SQLite), "does not know", "a newer schema is not ready")
+	_, err = db.Exec("DELETE FROM schema_migrations WHERE version = 9999")
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Seed(ctx, db))
+	require.NoError(t, storage.Seed(ctx, db), "seeding twice keeps one account per name")
+	var users int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users))
+	assert.Equal(t, 2, users)
+
+	require.NoError(t, storage.MigrateDown(ctx, db, storage.SQLite, len(all)))
+	pending, err = storage.PendingMigrations(ctx, db, storage.SQLite)
+	require.NoError(t, err)
+	assert.Equal(t, len(all), pending)
+	_, err = db.Exec("SELECT 1 FROM movies")
+	assert.Error(t, err, "the tables are dropped")
+
+	require.NoError(t, storage.Migrate(ctx, db, storage.SQLite))
+	_, err = db.Exec("SELECT 1 FROM movies")
+	assert.NoError(t, err)
+}
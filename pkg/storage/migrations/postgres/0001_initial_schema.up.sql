@@ -1,8 +1,4 @@
-DROP TABLE IF EXISTS actor_movie;
-DROP TABLE IF EXISTS actors;
-DROP TABLE IF EXISTS movies;
-DROP TABLE IF EXISTS users;
-
+-- IF NOT EXISTS adopts databases created by the former init-db.sql.
 CREATE TABLE IF NOT EXISTS actors (
     id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
@@ -32,10 +28,3 @@ CREATE TABLE IF NOT EXISTS users (
     password VARCHAR(255) NOT NULL,
     role int NOT NULL
 );
-
-
--- Test data
--- Login: admin, Password: admin
-INSERT INTO users (username, password, role) VALUES ('admin', '$2a$10$NjIPpHePTDy5hJs/JmX90uWxWT5jOqrw0OyrBg88lmiQvlHQHbAXu', 1); 
--- Login: user, Password: user
-INSERT INTO users (username, password, role) VALUES ('user', '$2a$10$ajvqHTuI3ixFdkI2WUJrF.KPPp2etsdgtj/jccMH0yek7W8JZK3P6', 2);
\ No newline at end of file
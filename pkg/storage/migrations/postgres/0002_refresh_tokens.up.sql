@@ -0,0 +1,18 @@
+-- Refresh tokens are kept as SHA-256 hashes. A family is the chain of tokens
+-- rotated from the same login; reusing a rotated token revokes it whole.
+CREATE TABLE refresh_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    family_id CHAR(32) NOT NULL,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- Access tokens revoked before they expire, by their jti claim.
+CREATE TABLE revoked_tokens (
+    jti CHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
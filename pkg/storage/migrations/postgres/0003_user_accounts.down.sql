@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS invites;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
@@ -0,0 +1,4 @@
+ALTER TABLE invites DROP CONSTRAINT IF EXISTS invites_role_fkey;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
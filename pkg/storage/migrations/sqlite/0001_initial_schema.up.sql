@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS actors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    gender VARCHAR(50),
+    birthdate DATE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS movies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title VARCHAR(150) NOT NULL,
+    description TEXT,
+    release_date DATE NOT NULL,
+    rating DECIMAL(3, 1) CHECK (rating >= 0 AND rating <= 10)
+);
+
+CREATE TABLE IF NOT EXISTS actor_movie (
+    actor_id INT NOT NULL,
+    movie_id INT NOT NULL,
+    PRIMARY KEY (actor_id, movie_id),
+    FOREIGN KEY (actor_id) REFERENCES actors (id) ON DELETE CASCADE,
+    FOREIGN KEY (movie_id) REFERENCES movies (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    role int NOT NULL
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS invites;
+ALTER TABLE users DROP COLUMN disabled;
+DROP INDEX IF EXISTS users_username_key;
@@ -0,0 +1,15 @@
+-- Fails if a username is taken twice; rename the duplicates first.
+CREATE UNIQUE INDEX users_username_key ON users (username);
+
+-- Disabled accounts can neither log in nor refresh their tokens.
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0;
+
+-- Invites to register while registration is invite-only, kept as SHA-256
+-- hashes of their codes. Each invite registers one account with its role.
+CREATE TABLE invites (
+    code_hash CHAR(64) PRIMARY KEY,
+    role INT NOT NULL,
+    created_by INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at DATETIME NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT 0
+);
@@ -0,0 +1,28 @@
+-- Roles grant named permissions, which the routes require. Accounts, invites
+-- and tokens keep referring to roles by ID: the former administrator and user
+-- roles become admin and viewer.
+-- SQLite cannot add foreign keys to the existing users and invites tables:
+-- the store checks that a deleted role is unused instead.
+CREATE TABLE roles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL UNIQUE
+);
+
+CREATE TABLE role_permissions (
+    role_id INT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission VARCHAR(50) NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+
+INSERT INTO roles (id, name) VALUES (1, 'admin'), (2, 'viewer'), (3, 'editor'), (4, 'moderator');
+
+INSERT INTO role_permissions (role_id, permission) VALUES
+    (1, 'movies:read'), (1, 'movies:write'), (1, 'movies:delete'),
+    (1, 'actors:read'), (1, 'actors:write'), (1, 'actors:delete'),
+    (1, 'users:read'), (1, 'users:write'), (1, 'users:invite'),
+    (1, 'roles:read'), (1, 'roles:write'),
+    (2, 'movies:read'), (2, 'actors:read'),
+    (3, 'movies:read'), (3, 'movies:write'), (3, 'actors:read'), (3, 'actors:write'),
+    (4, 'movies:read'), (4, 'movies:write'), (4, 'movies:delete'),
+    (4, 'actors:read'), (4, 'actors:write'), (4, 'actors:delete'),
+    (4, 'users:read'), (4, 'users:invite');
@@ -0,0 +1,7 @@
+-- Demo accounts, created by the optional seed step.
+-- Login: admin, Password: admin
+INSERT INTO users (username, password, role) SELECT 'admin', '$2a$10$NjIPpHePTDy5hJs/JmX90uWxWT5jOqrw0OyrBg88lmiQvlHQHbAXu', 1
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE username = 'admin');
+-- Login: user, Password: user
+INSERT INTO users (username, password, role) SELECT 'user', '$2a$10$ajvqHTuI3ixFdkI2WUJrF.KPPp2etsdgtj/jccMH0yek7W8JZK3P6', 2
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE username = 'user');
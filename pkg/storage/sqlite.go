@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens the SQLite database file at path, creating the file when
+// missing, and applies the pending migrations if migrate is set. Foreign keys
+// are enforced and transactions take the write lock when they begin, waiting
+// up to five seconds for it.
+func OpenSQLite(ctx context.Context, path string, migrate bool) (*sql.DB, error) {
+	params := url.Values{
+		"_pragma":      {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+		"_txlock":      {"immediate"},
+		"_time_format": {"sqlite"},
+	}
+	db, err := open("sqlite", "file:"+path+"?"+params.Encode(), semconv.DBSystemSqlite)
+	if err != nil {
+		return nil, err
+	}
+
+	if migrate {
+		if err := Migrate(ctx, db, SQLite); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
@@ -0,0 +1,247 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/axywe/filmotheka_vk/internal/logging"
+	"github.com/axywe/filmotheka_vk/pkg/actor"
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+// actorColumns lists the fields actors can be sorted by.
+var actorColumns = query.Columns{
+	"id": "id",
+}
+
+func (s *Store) ListActors(ctx context.Context, q actor.ActorQuery) (actor.ActorList, error) {
+	list := actor.ActorList{Actors: []actor.Actor{}}
+
+	b := query.NewFor(s.dialect)
+	countStatement, countArgs := b.Build("SELECT COUNT(*) FROM actors")
+	if err := s.db.QueryRowContext(ctx, countStatement, countArgs...).Scan(&list.Total); err != nil {
+		return list, err
+	}
+	if list.Total == 0 {
+		return list, nil
+	}
+
+	page := q.Page
+	if page.Cursor != nil {
+		b.Seek(*page.Cursor, "id", "id", page.Cursor.ID)
+	}
+	b.OrderBy(actorColumns, "id", page.Backward())
+	if page.Limit > 0 {
+		b.Limit(page.Limit + 1)
+	}
+	if page.Offset > 0 {
+		b.Offset(page.Offset)
+	}
+
+	statement, args := b.Build("SELECT id, name, gender, birthdate FROM actors")
+	logging.FromContext(ctx).Debug("sql", "statement", statement, "args", args)
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+
+	actors := []actor.Actor{}
+	for rows.Next() {
+		var a actor.Actor
+		if err := rows.Scan(&a.ID, &a.Name, &a.Gender, &a.Birthdate); err != nil {
+			return list, err
+		}
+		actors = append(actors, a)
+	}
+	if err := rows.Err(); err != nil {
+		return list, err
+	}
+
+	list.More = page.Limit > 0 && len(actors) > page.Limit
+	if list.More {
+		actors = actors[:page.Limit]
+	}
+	if page.Backward() {
+		for i, j := 0, len(actors)-1; i < j; i, j = i+1, j-1 {
+			actors[i], actors[j] = actors[j], actors[i]
+		}
+	}
+	list.Actors = actors
+
+	err = s.loadMovies(ctx, s.db, actors)
+	return list, err
+}
+
+func (s *Store) GetActor(ctx context.Context, id int) (actor.Actor, error) {
+	var a actor.Actor
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, gender, birthdate FROM actors WHERE id = $1", id).Scan(&a.ID, &a.Name, &a.Gender, &a.Birthdate)
+	if err == sql.ErrNoRows {
+		return a, storage.ErrNotFound
+	} else if err != nil {
+		return a, err
+	}
+
+	a.Movies, err = getMoviesForActor(ctx, s.db, a.ID)
+	return a, err
+}
+
+func (s *Store) CreateActor(ctx context.Context, a actor.Actor) (actor.Actor, error) {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		sqlStatement := `INSERT INTO actors (name, gender, birthdate) VALUES ($1, $2, $3) RETURNING id`
+		if err := tx.QueryRowContext(ctx, sqlStatement, a.Name, a.Gender, a.Birthdate).Scan(&a.ID); err != nil {
+			return err
+		}
+		if err := setMovies(ctx, tx, a.ID, a.Movies); err != nil {
+			return err
+		}
+		var err error
+		a.Movies, err = getMoviesForActor(ctx, tx, a.ID)
+		return err
+	})
+	return a, err
+}
+
+func (s *Store) SaveActor(ctx context.Context, a actor.Actor) (actor.Actor, error) {
+	var saved actor.Actor
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		saved, err = s.saveActor(ctx, tx, a)
+		return err
+	})
+	return saved, err
+}
+
+func (s *Store) UpdateActor(ctx context.Context, id int, update func(a *actor.Actor) error) (actor.Actor, error) {
+	var saved actor.Actor
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var a actor.Actor
+		sqlStatement := `SELECT id, name, gender, birthdate FROM actors WHERE id = $1` + s.dialect.ForUpdate()
+		err := tx.QueryRowContext(ctx, sqlStatement, id).Scan(&a.ID, &a.Name, &a.Gender, &a.Birthdate)
+		if err == sql.ErrNoRows {
+			return storage.ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if err := update(&a); err != nil {
+			return err
+		}
+		saved, err = s.saveActor(ctx, tx, a)
+		return err
+	})
+	return saved, err
+}
+
+func (s *Store) DeleteActor(ctx context.Context, id int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		sqlStatement := `DELETE FROM actor_movie WHERE actor_id = $1;`
+		if _, err := tx.ExecContext(ctx, sqlStatement, id); err != nil {
+			return err
+		}
+
+		sqlStatement = `DELETE FROM actors WHERE id = $1;`
+		result, err := tx.ExecContext(ctx, sqlStatement, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return storage.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// saveActor stores every member of a inside tx and replaces the filmography
+// when a.Movies is not nil. It returns the actor as persisted.
+func (s *Store) saveActor(ctx context.Context, tx *sql.Tx, a actor.Actor) (actor.Actor, error) {
+	var saved actor.Actor
+	sqlStatement := `UPDATE actors SET name = $2, gender = $3, birthdate = $4 WHERE id = $1 RETURNING id, name, gender, birthdate;`
+	err := tx.QueryRowContext(ctx, sqlStatement, a.ID, a.Name, a.Gender, a.Birthdate).Scan(&saved.ID, &saved.Name, &saved.Gender, &saved.Birthdate)
+	if err == sql.ErrNoRows {
+		return saved, storage.ErrNotFound
+	} else if err != nil {
+		return saved, err
+	}
+
+	if a.Movies != nil {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM actor_movie WHERE actor_id = $1", a.ID); err != nil {
+			return saved, err
+		}
+		if err := setMovies(ctx, tx, a.ID, a.Movies); err != nil {
+			return saved, err
+		}
+	}
+
+	saved.Movies, err = getMoviesForActor(ctx, tx, saved.ID)
+	return saved, err
+}
+
+// setMovies links an actor to the given movies inside tx. A movie that does
+// not exist makes the statement fail with a foreign key violation.
+func setMovies(ctx context.Context, tx *sql.Tx, actorID int, movies []actor.MovieBrief) error {
+	for _, m := range movies {
+		sqlStatement := `INSERT INTO actor_movie (actor_id, movie_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		if _, err := tx.ExecContext(ctx, sqlStatement, actorID, m.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMovies fills in the filmography of every actor with a single query.
+func (s *Store) loadMovies(ctx context.Context, q queryer, actors []actor.Actor) error {
+	if len(actors) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(actors))
+	index := make(map[int]int, len(actors))
+	for i, a := range actors {
+		ids[i] = int64(a.ID)
+		index[a.ID] = i
+	}
+
+	sqlStatement := `SELECT am.actor_id, m.id, m.title FROM movies m JOIN actor_movie am ON am.movie_id = m.id WHERE ` + s.dialect.AnyOf("am.actor_id", "$1") + ` ORDER BY m.id;`
+	rows, err := q.QueryContext(ctx, sqlStatement, s.dialect.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var actorID int
+		var m actor.MovieBrief
+		if err := rows.Scan(&actorID, &m.ID, &m.Title); err != nil {
+			return err
+		}
+		i := index[actorID]
+		actors[i].Movies = append(actors[i].Movies, m)
+	}
+	return rows.Err()
+}
+
+func getMoviesForActor(ctx context.Context, q queryer, actorID int) ([]actor.MovieBrief, error) {
+	var movies []actor.MovieBrief
+
+	sqlStatement := `SELECT m.id, m.title FROM movies m JOIN actor_movie am ON am.movie_id = m.id WHERE am.actor_id = $1;`
+	rows, err := q.QueryContext(ctx, sqlStatement, actorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m actor.MovieBrief
+		if err := rows.Scan(&m.ID, &m.Title); err != nil {
+			return nil, err
+		}
+		movies = append(movies, m)
+	}
+
+	return movies, rows.Err()
+}
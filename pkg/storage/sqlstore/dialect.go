@@ -0,0 +1,112 @@
+package sqlstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect adapts the statements of the store to a database engine. Both
+// supported engines accept $N placeholders, RETURNING and
+// ON CONFLICT DO NOTHING; the constructs below are spelled differently.
+type Dialect interface {
+	query.Dialect
+	// AnyOf returns a condition testing whether expr is one of the IDs bound
+	// to placeholder. The IDs must be bound as Array(ids).
+	AnyOf(expr, placeholder string) string
+	Array(ids []int64) interface{}
+	// ForUpdate returns the clause locking the rows read by a SELECT until
+	// the end of the transaction, if the engine has one.
+	ForUpdate() string
+	// TranslateError maps constraint and concurrency errors onto the errors
+	// of package storage. Other errors are returned unchanged.
+	TranslateError(err error) error
+}
+
+var (
+	Postgres Dialect = postgresDialect{}
+	// SQLite expects a database opened with foreign keys enabled, see
+	// storage.OpenSQLite. LIKE folds the case of ASCII letters only.
+	SQLite Dialect = sqliteDialect{}
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Match(expr, placeholder string) string {
+	return fmt.Sprintf("%s ILIKE %s", expr, placeholder)
+}
+
+func (postgresDialect) Unlimited() string {
+	return ""
+}
+
+func (postgresDialect) AnyOf(expr, placeholder string) string {
+	return fmt.Sprintf("%s = ANY(%s)", expr, placeholder)
+}
+
+func (postgresDialect) Array(ids []int64) interface{} {
+	return pq.Array(ids)
+}
+
+func (postgresDialect) ForUpdate() string {
+	return " FOR UPDATE"
+}
+
+func (postgresDialect) TranslateError(err error) error {
+	return storage.TranslateError(err)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Match(expr, placeholder string) string {
+	return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, expr, placeholder)
+}
+
+// Unlimited is a negative LIMIT, which SQLite reads as no limit: its OFFSET
+// can only follow a LIMIT.
+func (sqliteDialect) Unlimited() string {
+	return " LIMIT -1"
+}
+
+func (sqliteDialect) AnyOf(expr, placeholder string) string {
+	return fmt.Sprintf("%s IN (SELECT value FROM json_each(%s))", expr, placeholder)
+}
+
+// Array binds the IDs as a JSON array, which json_each expands into rows.
+func (sqliteDialect) Array(ids []int64) interface{} {
+	raw, _ := json.Marshal(ids)
+	return string(raw)
+}
+
+// ForUpdate is empty: SQLite locks the whole database for writing instead,
+// and databases opened by storage.OpenSQLite take that lock as soon as a
+// transaction begins.
+func (sqliteDialect) ForUpdate() string {
+	return ""
+}
+
+func (sqliteDialect) TranslateError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return storage.Invalid("Foreign key constraint violation")
+	case sqlite3.SQLITE_CONSTRAINT_CHECK, sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+		return storage.Invalid("Value violates a constraint: " + sqliteErr.Error())
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return storage.ErrConflict
+	}
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return storage.ErrConflict
+	}
+	return err
+}
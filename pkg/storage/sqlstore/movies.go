@@ -0,0 +1,304 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/axywe/filmotheka_vk/internal/logging"
+	"github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+// movieColumns maps the fields movies can be sorted by onto the columns of
+// the listing subquery.
+var movieColumns = query.Columns{
+	"title":        "s.title",
+	"rating":       "s.rating",
+	"release_date": "s.release_date",
+}
+
+func (s *Store) ListMovies(ctx context.Context, q movie.MovieQuery) (movie.MovieList, error) {
+	list := movie.MovieList{Movies: []movie.Movie{}}
+
+	b := query.NewFor(s.dialect)
+	titleMatch := "FALSE"
+	actorMatch := "NULL"
+	if q.Any != "" {
+		pattern := b.Arg(query.ContainsPattern(q.Any))
+		titleMatch = b.Match("m.title", pattern)
+		actorMatch = matchedActor(b, pattern)
+		b.Where("(s.title_match OR s.matched_actor IS NOT NULL)")
+	} else {
+		if q.Title != "" {
+			titleMatch = b.Contains("m.title", q.Title)
+			b.Where("s.title_match")
+		}
+		if q.Actor != "" {
+			actorMatch = matchedActor(b, b.Arg(query.ContainsPattern(q.Actor)))
+			b.Where("s.matched_actor IS NOT NULL")
+		}
+	}
+
+	base := fmt.Sprintf("SELECT m.id, m.title, m.description, m.release_date, m.rating, %s AS title_match, %s AS matched_actor FROM movies m", titleMatch, actorMatch)
+	countStatement, countArgs := b.Build("SELECT COUNT(*) FROM (" + base + ") s")
+	if err := s.db.QueryRowContext(ctx, countStatement, countArgs...).Scan(&list.Total); err != nil {
+		return list, err
+	}
+
+	page := q.Page
+	if page.Cursor != nil {
+		b.Seek(*page.Cursor, movieColumns[q.SortBy], "s.id", q.SeekValue)
+	}
+	b.OrderBy(movieColumns, q.SortBy, q.Desc != page.Backward())
+	b.ThenBy("s.id", q.Desc != page.Backward())
+	if page.Limit > 0 {
+		b.Limit(page.Limit + 1)
+	}
+	if page.Offset > 0 {
+		b.Offset(page.Offset)
+	}
+
+	statement, args := b.Build("SELECT * FROM (" + base + ") s")
+	logging.FromContext(ctx).Debug("sql", "statement", statement, "args", args)
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m movie.Movie
+		var matchedTitle bool
+		var matchedActor sql.NullString
+		if err := rows.Scan(&m.ID, &m.Title, &m.Description, &m.ReleaseDate, &m.Rating, &matchedTitle, &matchedActor); err != nil {
+			return list, err
+		}
+		if q.Searching() {
+			m.Match = &movie.SearchMatch{Title: matchedTitle, Actor: matchedActor.String}
+		}
+		list.Movies = append(list.Movies, m)
+	}
+	if err := rows.Err(); err != nil {
+		return list, err
+	}
+	if list.Total == 0 {
+		return list, nil
+	}
+
+	movies := list.Movies
+	list.More = page.Limit > 0 && len(movies) > page.Limit
+	if list.More {
+		movies = movies[:page.Limit]
+	}
+	if page.Backward() {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+	list.Movies = movies
+
+	err = s.loadCasts(ctx, s.db, movies)
+	return list, err
+}
+
+func (s *Store) GetMovie(ctx context.Context, id int) (movie.Movie, error) {
+	var m movie.Movie
+	sqlStatement := `SELECT id, title, description, release_date, rating FROM movies WHERE id = $1;`
+	err := s.db.QueryRowContext(ctx, sqlStatement, id).Scan(&m.ID, &m.Title, &m.Description, &m.ReleaseDate, &m.Rating)
+	if err == sql.ErrNoRows {
+		return m, storage.ErrNotFound
+	} else if err != nil {
+		return m, err
+	}
+
+	movies := []movie.Movie{m}
+	err = s.loadCasts(ctx, s.db, movies)
+	return movies[0], err
+}
+
+func (s *Store) CreateMovie(ctx context.Context, m movie.Movie) (movie.Movie, error) {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		sqlStatement := `INSERT INTO movies (title, description, release_date, rating) VALUES ($1, $2, $3, $4) RETURNING id`
+		if err := tx.QueryRowContext(ctx, sqlStatement, m.Title, m.Description, m.ReleaseDate, m.Rating).Scan(&m.ID); err != nil {
+			return err
+		}
+		cast, err := s.setCast(ctx, tx, m.ID, m.Actors)
+		m.Actors = cast
+		return err
+	})
+	return m, err
+}
+
+func (s *Store) SaveMovie(ctx context.Context, m movie.Movie) (movie.Movie, error) {
+	var saved movie.Movie
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		saved, err = s.saveMovie(ctx, tx, m)
+		return err
+	})
+	return saved, err
+}
+
+func (s *Store) UpdateMovie(ctx context.Context, id int, update func(m *movie.Movie) error) (movie.Movie, error) {
+	var saved movie.Movie
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var m movie.Movie
+		sqlStatement := `SELECT id, title, description, release_date, rating FROM movies WHERE id = $1` + s.dialect.ForUpdate()
+		err := tx.QueryRowContext(ctx, sqlStatement, id).Scan(&m.ID, &m.Title, &m.Description, &m.ReleaseDate, &m.Rating)
+		if err == sql.ErrNoRows {
+			return storage.ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if err := update(&m); err != nil {
+			return err
+		}
+		saved, err = s.saveMovie(ctx, tx, m)
+		return err
+	})
+	return saved, err
+}
+
+func (s *Store) DeleteMovie(ctx context.Context, id int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		sqlStatement := `DELETE FROM actor_movie WHERE movie_id = $1;`
+		if _, err := tx.ExecContext(ctx, sqlStatement, id); err != nil {
+			return err
+		}
+
+		sqlStatement = `DELETE FROM movies WHERE id = $1;`
+		result, err := tx.ExecContext(ctx, sqlStatement, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return storage.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// saveMovie stores every member of m inside tx and replaces the cast when
+// m.Actors is not nil. It returns the movie as persisted.
+func (s *Store) saveMovie(ctx context.Context, tx *sql.Tx, m movie.Movie) (movie.Movie, error) {
+	var saved movie.Movie
+	sqlStatement := `UPDATE movies SET title = $2, description = $3, release_date = $4, rating = $5 WHERE id = $1 RETURNING id, title, description, release_date, rating;`
+	err := tx.QueryRowContext(ctx, sqlStatement, m.ID, m.Title, m.Description, m.ReleaseDate, m.Rating).
+		Scan(&saved.ID, &saved.Title, &saved.Description, &saved.ReleaseDate, &saved.Rating)
+	if err == sql.ErrNoRows {
+		return saved, storage.ErrNotFound
+	} else if err != nil {
+		return saved, err
+	}
+
+	if m.Actors != nil {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM actor_movie WHERE movie_id = $1", m.ID); err != nil {
+			return saved, err
+		}
+		if _, err := s.setCast(ctx, tx, m.ID, m.Actors); err != nil {
+			return saved, err
+		}
+	}
+
+	movies := []movie.Movie{saved}
+	err = s.loadCasts(ctx, tx, movies)
+	return movies[0], err
+}
+
+// matchedActor returns a subquery selecting the first cast member of movie m
+// whose name matches the pattern bound to placeholder.
+func matchedActor(b *query.Builder, placeholder string) string {
+	return fmt.Sprintf("(SELECT a.name FROM actor_movie am JOIN actors a ON a.id = am.actor_id WHERE am.movie_id = m.id AND %s ORDER BY a.name LIMIT 1)", b.Match("a.name", placeholder))
+}
+
+// loadCasts fills in the cast of every movie with a single query.
+func (s *Store) loadCasts(ctx context.Context, q queryer, movies []movie.Movie) error {
+	ids := make([]int64, len(movies))
+	index := make(map[int]int, len(movies))
+	for i, m := range movies {
+		ids[i] = int64(m.ID)
+		index[m.ID] = i
+	}
+
+	sqlStatement := `SELECT am.movie_id, a.id, a.name FROM actor_movie am JOIN actors a ON a.id = am.actor_id WHERE ` + s.dialect.AnyOf("am.movie_id", "$1") + ` ORDER BY a.name, a.id;`
+	rows, err := q.QueryContext(ctx, sqlStatement, s.dialect.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID int
+		var a movie.ActorBrief
+		if err := rows.Scan(&movieID, &a.ID, &a.Name); err != nil {
+			return err
+		}
+		i := index[movieID]
+		movies[i].Actors = append(movies[i].Actors, a)
+	}
+	return rows.Err()
+}
+
+// setCast links the given actors to a movie inside tx. Every actor must exist,
+// otherwise a *storage.InvalidError is returned. The returned cast carries
+// actor names.
+func (s *Store) setCast(ctx context.Context, tx *sql.Tx, movieID int, actors []movie.ActorBrief) ([]movie.ActorBrief, error) {
+	if len(actors) == 0 {
+		return actors, nil
+	}
+
+	ids := []int64{}
+	seen := make(map[int]bool)
+	for _, a := range actors {
+		if !seen[a.ID] {
+			seen[a.ID] = true
+			ids = append(ids, int64(a.ID))
+		}
+	}
+
+	sqlStatement := `SELECT id, name FROM actors WHERE ` + s.dialect.AnyOf("id", "$1") + ` ORDER BY name, id;`
+	rows, err := tx.QueryContext(ctx, sqlStatement, s.dialect.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	cast := []movie.ActorBrief{}
+	for rows.Next() {
+		var a movie.ActorBrief
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		cast = append(cast, a)
+		delete(seen, a.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(seen) > 0 {
+		missing := []string{}
+		for _, id := range ids {
+			if seen[int(id)] {
+				missing = append(missing, strconv.FormatInt(id, 10))
+			}
+		}
+		return nil, storage.Invalid("Actors not found: " + strings.Join(missing, ", "))
+	}
+
+	for _, a := range cast {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO actor_movie (actor_id, movie_id) VALUES ($1, $2)`, a.ID, movieID); err != nil {
+			return nil, err
+		}
+	}
+	return cast, nil
+}
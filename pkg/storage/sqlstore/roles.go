@@ -0,0 +1,142 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+func (s *Store) GetRole(ctx context.Context, id int) (auth.Role, error) {
+	r := auth.Role{ID: id, Permissions: []auth.Permission{}}
+	err := s.db.QueryRowContext(ctx, "SELECT name FROM roles WHERE id = $1", id).Scan(&r.Name)
+	if err == sql.ErrNoRows {
+		return r, storage.ErrNotFound
+	}
+	if err != nil {
+		return r, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT permission FROM role_permissions WHERE role_id = $1 ORDER BY permission", id)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p auth.Permission
+		if err := rows.Scan(&p); err != nil {
+			return r, err
+		}
+		r.Permissions = append(r.Permissions, p)
+	}
+	return r, rows.Err()
+}
+
+func (s *Store) ListRoles(ctx context.Context) ([]auth.Role, error) {
+	roles := []auth.Role{}
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name FROM roles ORDER BY id")
+	if err != nil {
+		return roles, err
+	}
+	defer rows.Close()
+	index := make(map[int]int)
+	for rows.Next() {
+		r := auth.Role{Permissions: []auth.Permission{}}
+		if err := rows.Scan(&r.ID, &r.Name); err != nil {
+			return roles, err
+		}
+		index[r.ID] = len(roles)
+		roles = append(roles, r)
+	}
+	if err := rows.Err(); err != nil {
+		return roles, err
+	}
+
+	permissions, err := s.db.QueryContext(ctx, "SELECT role_id, permission FROM role_permissions ORDER BY role_id, permission")
+	if err != nil {
+		return roles, err
+	}
+	defer permissions.Close()
+	for permissions.Next() {
+		var id int
+		var p auth.Permission
+		if err := permissions.Scan(&id, &p); err != nil {
+			return roles, err
+		}
+		if i, ok := index[id]; ok {
+			roles[i].Permissions = append(roles[i].Permissions, p)
+		}
+	}
+	return roles, permissions.Err()
+}
+
+func (s *Store) CreateRole(ctx context.Context, r auth.Role) (auth.Role, error) {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, "INSERT INTO roles (name) VALUES ($1) RETURNING id", r.Name).Scan(&r.ID); err != nil {
+			return err
+		}
+		return grant(ctx, tx, r)
+	})
+	return r, err
+}
+
+func (s *Store) SaveRole(ctx context.Context, r auth.Role) (auth.Role, error) {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "UPDATE roles SET name = $1 WHERE id = $2", r.Name, r.ID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return storage.ErrNotFound
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role_id = $1", r.ID); err != nil {
+			return err
+		}
+		return grant(ctx, tx, r)
+	})
+	return r, err
+}
+
+// DeleteRole checks the accounts itself rather than relying on the foreign
+// key of users.role, which SQLite databases lack.
+func (s *Store) DeleteRole(ctx context.Context, id int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var assigned bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)", id).Scan(&assigned); err != nil {
+			return err
+		}
+		if assigned {
+			return storage.Invalid("Role is still assigned to accounts")
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM invites WHERE role = $1", id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM roles WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return storage.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// grant stores the permissions of r.
+func grant(ctx context.Context, tx *sql.Tx, r auth.Role) error {
+	for _, p := range r.Permissions {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO role_permissions (role_id, permission) VALUES ($1, $2)", r.ID, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
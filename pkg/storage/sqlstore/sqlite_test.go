@@ -0,0 +1,290 @@
+package sqlstore_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/actor"
+	"github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/storage/sqlstore"
+	"github.com/axywe/filmotheka_vk/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func openSQLite(t *testing.T) *sqlstore.Store {
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "filmotheka.db"), true)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return sqlstore.New(db, sqlstore.SQLite)
+}
+
+func TestSQLiteMovies(t *testing.T) {
+	s := openSQLite(t)
+	releaseDate := time.Date(2001, time.May, 4, 0, 0, 0, 0, time.UTC)
+
+	a, err := s.CreateActor(ctx, actor.Actor{Name: "Jane Roe", Gender: "Female", Birthdate: releaseDate})
+	require.NoError(t, err)
+	m, err := s.CreateMovie(ctx, movie.Movie{Title: "100% Roe", ReleaseDate: releaseDate, Rating: 7.5, Actors: []movie.ActorBrief{{ID: a.ID}}})
+	require.NoError(t, err)
+	assert.Equal(t, []movie.ActorBrief{{ID: a.ID, Name: "Jane Roe"}}, m.Actors)
+	_, err = s.CreateMovie(ctx, movie.Movie{Title: "1000 Days", ReleaseDate: releaseDate, Rating: 6})
+	require.NoError(t, err)
+
+	list, err := s.ListMovies(ctx, movie.MovieQuery{Title: "0%", SortBy: "rating", Desc: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, list.Total)
+	assert.Equal(t, m.ID, list.Movies[0].ID)
+	assert.True(t, list.Movies[0].ReleaseDate.Equal(releaseDate))
+
+	list, err = s.ListMovies(ctx, movie.MovieQuery{Any: "roe", SortBy: "title"})
+	require.NoError(t, err)
+	require.Equal(t, 1, list.Total)
+	assert.Equal(t, &movie.SearchMatch{Title: true, Actor: "Jane Roe"}, list.Movies[0].Match)
+
+	_, err = s.CreateMovie(ctx, movie.Movie{Title: "Ghost Cast", ReleaseDate: releaseDate, Actors: []movie.ActorBrief{{ID: a.ID + 1}}})
+	var invalid *storage.InvalidError
+	assert.True(t, errors.As(err, &invalid))
+
+	updated, err := s.UpdateMovie(ctx, m.ID, func(m *movie.Movie) error {
+		m.Rating = 0
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, updated.Rating)
+	assert.Len(t, updated.Actors, 1)
+
+	require.NoError(t, s.DeleteActor(ctx, a.ID))
+	m, err = s.GetMovie(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Empty(t, m.Actors)
+	assert.ErrorIs(t, s.DeleteActor(ctx, a.ID), storage.ErrNotFound)
+}
+
+func TestSQLiteActorsPaginated(t *testing.T) {
+	s := openSQLite(t)
+	m, err := s.CreateMovie(ctx, movie.Movie{Title: "Ensemble", ReleaseDate: time.Now()})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := s.CreateActor(ctx, actor.Actor{Name: "Actor", Birthdate: time.Now(), Movies: []actor.MovieBrief{{ID: m.ID}}})
+		require.NoError(t, err)
+	}
+
+	_, err = s.CreateActor(ctx, actor.Actor{Name: "Actor", Birthdate: time.Now(), Movies: []actor.MovieBrief{{ID: m.ID + 1}}})
+	var invalid *storage.InvalidError
+	assert.True(t, errors.As(err, &invalid))
+
+	list, err := s.ListActors(ctx, actor.ActorQuery{Page: query.Page{Limit: 2, Cursor: &query.Cursor{SortBy: "id", ID: 1}}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, list.Total)
+	assert.False(t, list.More)
+	require.Len(t, list.Actors, 2)
+	assert.Equal(t, 2, list.Actors[0].ID)
+	assert.Equal(t, []actor.MovieBrief{{ID: m.ID, Title: "Ensemble"}}, list.Actors[0].Movies)
+}
+
+func TestSQLiteOffsetWithoutLimit(t *testing.T) {
+	s := openSQLite(t)
+	page := query.Page{Offset: 1, Offsets: true}
+	for _, title := range []string{"First", "Second"} {
+		_, err := s.CreateMovie(ctx, movie.Movie{Title: title, ReleaseDate: time.Now()})
+		require.NoError(t, err)
+		_, err = s.CreateActor(ctx, actor.Actor{Name: title, Birthdate: time.Now()})
+		require.NoError(t, err)
+		_, err = s.CreateUser(ctx, auth.User{Username: title, Password: "hash", Role: auth.RoleViewer}, "")
+		require.NoError(t, err)
+	}
+
+	movies, err := s.ListMovies(ctx, movie.MovieQuery{Page: page})
+	require.NoError(t, err)
+	require.Len(t, movies.Movies, 1)
+	assert.Equal(t, "Second", movies.Movies[0].Title)
+	actors, err := s.ListActors(ctx, actor.ActorQuery{Page: page})
+	require.NoError(t, err)
+	require.Len(t, actors.Actors, 1)
+	assert.Equal(t, "Second", actors.Actors[0].Name)
+	users, err := s.ListUsers(ctx, user.UserQuery{Page: page})
+	require.NoError(t, err)
+	require.Len(t, users.Users, 1)
+	assert.Equal(t, "Second", users.Users[0].Username)
+}
+
+func TestSQLiteSeedUsers(t *testing.T) {
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "filmotheka.db"), true)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	s := sqlstore.New(db, sqlstore.SQLite)
+
+	_, err = s.GetUserByUsername(ctx, "admin")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	require.NoError(t, storage.Seed(ctx, db))
+
+	u, err := s.GetUserByUsername(ctx, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, 1, u.Role)
+	_, err = s.GetUserByUsername(ctx, "nobody")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestSQLiteTokens(t *testing.T) {
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "filmotheka.db"), true)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	s := sqlstore.New(db, sqlstore.SQLite)
+	require.NoError(t, storage.Seed(ctx, db))
+	admin, err := s.GetUserByUsername(ctx, "admin")
+	require.NoError(t, err)
+	byID, err := s.GetUserByID(ctx, admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, admin, byID)
+	_, err = s.GetUserByID(ctx, admin.ID+100)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	first := auth.RefreshToken{Hash: auth.HashToken("first"), FamilyID: "family", UserID: admin.ID, ExpiresAt: expiresAt}
+	require.NoError(t, s.SaveRefreshToken(ctx, first))
+	require.NoError(t, s.SaveRefreshToken(ctx, auth.RefreshToken{Hash: auth.HashToken("second"), FamilyID: "family", UserID: admin.ID, ExpiresAt: expiresAt}))
+	var invalid *storage.InvalidError
+	assert.ErrorAs(t, s.SaveRefreshToken(ctx, auth.RefreshToken{Hash: auth.HashToken("orphan"), FamilyID: "other", UserID: admin.ID + 100, ExpiresAt: expiresAt}), &invalid)
+
+	looked, err := s.GetRefreshToken(ctx, first.Hash)
+	require.NoError(t, err)
+	assert.False(t, looked.Used)
+	_, err = s.GetRefreshToken(ctx, auth.HashToken("unknown"))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	used, err := s.UseRefreshToken(ctx, first.Hash)
+	require.NoError(t, err)
+	assert.True(t, used.ExpiresAt.Equal(expiresAt))
+	used.ExpiresAt = expiresAt
+	assert.Equal(t, first, used, "the first use sees the token unused")
+	used, err = s.UseRefreshToken(ctx, first.Hash)
+	require.NoError(t, err)
+	assert.True(t, used.Used)
+	_, err = s.UseRefreshToken(ctx, auth.HashToken("unknown"))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, s.RevokeTokenFamily(ctx, "family"))
+	second, err := s.UseRefreshToken(ctx, auth.HashToken("second"))
+	require.NoError(t, err)
+	assert.True(t, second.Revoked)
+
+	revoked, err := s.AccessTokenRevoked(ctx, "jti")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	require.NoError(t, s.RevokeAccessToken(ctx, "jti", expiresAt))
+	require.NoError(t, s.RevokeAccessToken(ctx, "jti", expiresAt), "revoking twice is a no-op")
+	revoked, err = s.AccessTokenRevoked(ctx, "jti")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestSQLiteUsers(t *testing.T) {
+	s := openSQLite(t)
+
+	admin, err := s.CreateUser(ctx, auth.User{Username: "admin", Password: "hash", Role: auth.RoleAdmin}, "")
+	require.NoError(t, err)
+	_, err = s.CreateUser(ctx, auth.User{Username: "admin", Password: "hash", Role: auth.RoleViewer}, "")
+	assert.ErrorIs(t, err, storage.ErrConflict, "usernames are unique")
+
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	require.NoError(t, s.SaveInvite(ctx, user.Invite{Hash: auth.HashToken("code"), Role: auth.RoleAdmin, CreatedBy: admin.ID, ExpiresAt: expiresAt}))
+	require.NoError(t, s.SaveInvite(ctx, user.Invite{Hash: auth.HashToken("expired"), Role: auth.RoleAdmin, CreatedBy: admin.ID, ExpiresAt: time.Now().Add(-time.Second).UTC()}))
+	var invalid *storage.InvalidError
+	_, err = s.CreateUser(ctx, auth.User{Username: "late", Password: "hash", Role: auth.RoleViewer}, auth.HashToken("expired"))
+	assert.ErrorAs(t, err, &invalid)
+
+	// A failed registration leaves the invite unused.
+	_, err = s.CreateUser(ctx, auth.User{Username: "admin", Password: "hash", Role: auth.RoleViewer}, auth.HashToken("code"))
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	invited, err := s.CreateUser(ctx, auth.User{Username: "invited", Password: "hash", Role: auth.RoleViewer}, auth.HashToken("code"))
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleAdmin, invited.Role, "the account has the role of the invite")
+	_, err = s.CreateUser(ctx, auth.User{Username: "again", Password: "hash", Role: auth.RoleViewer}, auth.HashToken("code"))
+	assert.ErrorAs(t, err, &invalid, "an invite registers one account")
+
+	require.NoError(t, s.SaveRefreshToken(ctx, auth.RefreshToken{Hash: auth.HashToken("refresh"), FamilyID: "family", UserID: invited.ID, ExpiresAt: expiresAt}))
+	updated, err := s.UpdateUser(ctx, invited.ID, func(u *auth.User) error {
+		u.Role = auth.RoleViewer
+		u.Disabled = true
+		return nil
+	})
+	require.NoError(t, err)
+	stored, err := s.GetUserByUsername(ctx, "invited")
+	require.NoError(t, err)
+	assert.Equal(t, updated, stored)
+	assert.True(t, stored.Disabled)
+	_, err = s.UpdateUser(ctx, invited.ID+100, func(u *auth.User) error { return nil })
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.UpdateUser(ctx, invited.ID, func(u *auth.User) error {
+		u.Username = "admin"
+		return nil
+	})
+	assert.ErrorIs(t, err, storage.ErrConflict)
+
+	require.NoError(t, s.RevokeUserTokens(ctx, invited.ID))
+	token, err := s.UseRefreshToken(ctx, auth.HashToken("refresh"))
+	require.NoError(t, err)
+	assert.True(t, token.Revoked)
+
+	list, err := s.ListUsers(ctx, user.UserQuery{Page: query.Page{Limit: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, list.Total)
+	assert.True(t, list.More)
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, admin.ID, list.Users[0].ID)
+}
+
+func TestSQLiteRoles(t *testing.T) {
+	s := openSQLite(t)
+
+	roles, err := s.ListRoles(ctx)
+	require.NoError(t, err)
+	require.Len(t, roles, 4, "the migration creates admin, viewer, editor and moderator")
+	assert.Equal(t, "admin", roles[0].Name)
+	assert.ElementsMatch(t, auth.Permissions, roles[0].Permissions)
+	viewer, err := s.GetRole(ctx, auth.RoleViewer)
+	require.NoError(t, err)
+	assert.Equal(t, auth.Role{ID: auth.RoleViewer, Name: "viewer", Permissions: []auth.Permission{auth.ActorsRead, auth.MoviesRead}}, viewer)
+
+	critic, err := s.CreateRole(ctx, auth.Role{Name: "critic", Permissions: []auth.Permission{auth.MoviesRead}})
+	require.NoError(t, err)
+	assert.Equal(t, 5, critic.ID)
+	_, err = s.CreateRole(ctx, auth.Role{Name: "critic", Permissions: []auth.Permission{}})
+	assert.ErrorIs(t, err, storage.ErrConflict, "role names are unique")
+
+	critic.Permissions = []auth.Permission{auth.MoviesRead, auth.MoviesWrite}
+	_, err = s.SaveRole(ctx, critic)
+	require.NoError(t, err)
+	stored, err := s.GetRole(ctx, critic.ID)
+	require.NoError(t, err)
+	assert.Equal(t, critic, stored)
+	_, err = s.SaveRole(ctx, auth.Role{ID: 100, Name: "ghost"})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	critics, err := s.CreateUser(ctx, auth.User{Username: "critic", Password: "hash", Role: critic.ID}, "")
+	require.NoError(t, err)
+	require.NoError(t, s.SaveInvite(ctx, user.Invite{Hash: auth.HashToken("critic"), Role: critic.ID, CreatedBy: critics.ID, ExpiresAt: time.Now().Add(time.Hour).UTC()}))
+	var invalid *storage.InvalidError
+	assert.ErrorAs(t, s.DeleteRole(ctx, critic.ID), &invalid, "a role that accounts have cannot be deleted")
+
+	_, err = s.UpdateUser(ctx, critics.ID, func(u *auth.User) error {
+		u.Role = auth.RoleViewer
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteRole(ctx, critic.ID))
+	_, err = s.GetRole(ctx, critic.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.CreateUser(ctx, auth.User{Username: "late", Password: "hash"}, auth.HashToken("critic"))
+	assert.ErrorAs(t, err, &invalid, "the invites to a deleted role are deleted")
+	assert.ErrorIs(t, s.DeleteRole(ctx, critic.ID), storage.ErrNotFound)
+}
@@ -0,0 +1,46 @@
+// Package sqlstore implements the movie, actor, user and role stores on top
+// of a SQL database, PostgreSQL or SQLite.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/actor"
+	"github.com/axywe/filmotheka_vk/pkg/movie"
+	"github.com/axywe/filmotheka_vk/pkg/role"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/user"
+)
+
+// Store implements movie.MovieStore, actor.ActorStore, auth.Store,
+// user.UserStore and role.RoleStore.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// New returns a store on db, which speaks the given dialect.
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{db: db, dialect: dialect}
+}
+
+// withTx runs fn inside a transaction like storage.WithTx and translates the
+// errors of the dialect.
+func (s *Store) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.dialect.TranslateError(storage.WithTx(ctx, s.db, fn))
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+var (
+	_ movie.MovieStore = (*Store)(nil)
+	_ actor.ActorStore = (*Store)(nil)
+	_ auth.Store       = (*Store)(nil)
+	_ user.UserStore   = (*Store)(nil)
+	_ role.RoleStore   = (*Store)(nil)
+)
@@ -0,0 +1,72 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+)
+
+// SaveRefreshToken stores t and deletes the refresh tokens that have expired.
+func (s *Store) SaveRefreshToken(ctx context.Context, t auth.RefreshToken) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < $1", time.Now().UTC()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, family_id, user_id, expires_at) VALUES ($1, $2, $3, $4)",
+			t.Hash, t.FamilyID, t.UserID, t.ExpiresAt.UTC())
+		return err
+	})
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, hash string) (auth.RefreshToken, error) {
+	t := auth.RefreshToken{Hash: hash}
+	err := s.db.QueryRowContext(ctx, "SELECT family_id, user_id, expires_at, used, revoked FROM refresh_tokens WHERE token_hash = $1", hash).
+		Scan(&t.FamilyID, &t.UserID, &t.ExpiresAt, &t.Used, &t.Revoked)
+	if err == sql.ErrNoRows {
+		return t, storage.ErrNotFound
+	}
+	return t, err
+}
+
+func (s *Store) UseRefreshToken(ctx context.Context, hash string) (auth.RefreshToken, error) {
+	t := auth.RefreshToken{Hash: hash}
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT family_id, user_id, expires_at, used, revoked FROM refresh_tokens WHERE token_hash = $1"+s.dialect.ForUpdate(), hash).
+			Scan(&t.FamilyID, &t.UserID, &t.ExpiresAt, &t.Used, &t.Revoked)
+		if err == sql.ErrNoRows {
+			return storage.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET used = TRUE WHERE token_hash = $1", hash)
+		return err
+	})
+	return t, err
+}
+
+func (s *Store) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE family_id = $1", familyID)
+	return s.dialect.TranslateError(err)
+}
+
+// RevokeAccessToken adds jti to the denylist and deletes the entries that
+// have expired.
+func (s *Store) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1", time.Now().UTC()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING", jti, expiresAt.UTC())
+		return err
+	})
+}
+
+func (s *Store) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	return revoked, err
+}
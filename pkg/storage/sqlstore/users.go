@@ -0,0 +1,155 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/logging"
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/pkg/user"
+)
+
+// userColumns lists the fields accounts can be sorted by.
+var userColumns = query.Columns{
+	"id": "id",
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (auth.User, error) {
+	u := auth.User{Username: username}
+	err := s.db.QueryRowContext(ctx, "SELECT id, password, role, disabled FROM users WHERE username = $1", username).Scan(&u.ID, &u.Password, &u.Role, &u.Disabled)
+	if err == sql.ErrNoRows {
+		return u, storage.ErrNotFound
+	}
+	return u, err
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id int) (auth.User, error) {
+	u := auth.User{ID: id}
+	err := s.db.QueryRowContext(ctx, "SELECT username, password, role, disabled FROM users WHERE id = $1", id).Scan(&u.Username, &u.Password, &u.Role, &u.Disabled)
+	if err == sql.ErrNoRows {
+		return u, storage.ErrNotFound
+	}
+	return u, err
+}
+
+func (s *Store) ListUsers(ctx context.Context, q user.UserQuery) (user.UserList, error) {
+	list := user.UserList{Users: []auth.User{}}
+
+	b := query.NewFor(s.dialect)
+	countStatement, countArgs := b.Build("SELECT COUNT(*) FROM users")
+	if err := s.db.QueryRowContext(ctx, countStatement, countArgs...).Scan(&list.Total); err != nil {
+		return list, err
+	}
+	if list.Total == 0 {
+		return list, nil
+	}
+
+	page := q.Page
+	if page.Cursor != nil {
+		b.Seek(*page.Cursor, "id", "id", page.Cursor.ID)
+	}
+	b.OrderBy(userColumns, "id", page.Backward())
+	if page.Limit > 0 {
+		b.Limit(page.Limit + 1)
+	}
+	if page.Offset > 0 {
+		b.Offset(page.Offset)
+	}
+
+	statement, args := b.Build("SELECT id, username, password, role, disabled FROM users")
+	logging.FromContext(ctx).Debug("sql", "statement", statement, "args", args)
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+
+	users := []auth.User{}
+	for rows.Next() {
+		var u auth.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Password, &u.Role, &u.Disabled); err != nil {
+			return list, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return list, err
+	}
+
+	list.More = page.Limit > 0 && len(users) > page.Limit
+	if list.More {
+		users = users[:page.Limit]
+	}
+	if page.Backward() {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	list.Users = users
+	return list, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, u auth.User, invite string) (auth.User, error) {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if invite != "" {
+			var expiresAt time.Time
+			var used bool
+			err := tx.QueryRowContext(ctx, "SELECT role, expires_at, used FROM invites WHERE code_hash = $1"+s.dialect.ForUpdate(), invite).
+				Scan(&u.Role, &expiresAt, &used)
+			if err == sql.ErrNoRows || err == nil && (used || !time.Now().Before(expiresAt)) {
+				return storage.Invalid("Invalid or expired invite code")
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE invites SET used = TRUE WHERE code_hash = $1", invite); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRowContext(ctx, "INSERT INTO users (username, password, role, disabled) VALUES ($1, $2, $3, $4) RETURNING id",
+			u.Username, u.Password, u.Role, u.Disabled).Scan(&u.ID)
+	})
+	return u, err
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id int, update func(u *auth.User) error) (auth.User, error) {
+	var u auth.User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		u = auth.User{ID: id}
+		err := tx.QueryRowContext(ctx, "SELECT username, password, role, disabled FROM users WHERE id = $1"+s.dialect.ForUpdate(), id).
+			Scan(&u.Username, &u.Password, &u.Role, &u.Disabled)
+		if err == sql.ErrNoRows {
+			return storage.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := update(&u); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET username = $1, password = $2, role = $3, disabled = $4 WHERE id = $5",
+			u.Username, u.Password, u.Role, u.Disabled, id)
+		return err
+	})
+	return u, err
+}
+
+func (s *Store) RevokeUserTokens(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE user_id = $1", userID)
+	return s.dialect.TranslateError(err)
+}
+
+// SaveInvite stores i and deletes the invites that have expired.
+func (s *Store) SaveInvite(ctx context.Context, i user.Invite) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM invites WHERE expires_at < $1", time.Now().UTC()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO invites (code_hash, role, created_by, expires_at) VALUES ($1, $2, $3, $4)",
+			i.Hash, i.Role, i.CreatedBy, i.ExpiresAt.UTC())
+		return err
+	})
+}
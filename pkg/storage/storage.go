@@ -1,44 +1,84 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/XSAM/otelsql"
+	"github.com/axywe/filmotheka_vk/internal/config"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func InitDB() (*sql.DB, error) {
-	if err := godotenv.Load(".env"); err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
-	host := os.Getenv("POSTGRES_HOST")
-	port := os.Getenv("POSTGRES_PORT")
-	user := os.Getenv("POSTGRES_USER")
-	password := os.Getenv("POSTGRES_PASSWORD")
-	dbname := os.Getenv("POSTGRES_DB")
-	time.Sleep(5 * time.Second)
-
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
-	var db *sql.DB
-	var err error
-	for i := 0; i < 10; i++ {
-		db, err = sql.Open("postgres", connStr)
-		if err != nil {
-			log.Printf("Failed to connect to database. Retrying in 5 seconds... Attempt %d/%d\n", i+1, 10)
-			time.Sleep(5 * time.Second)
-		} else {
-			break
-		}
-	}
+// Delays between connection attempts. Each failed attempt doubles the delay
+// up to maxRetryDelay.
+var (
+	minRetryDelay = 100 * time.Millisecond
+	maxRetryDelay = 5 * time.Second
+)
 
-	err = db.Ping()
+// InitDB connects to the PostgreSQL database described by cfg and applies the
+// pending migrations if migrate is set. It keeps retrying the connection until
+// cfg.ConnectTimeout has elapsed or ctx is done.
+func InitDB(ctx context.Context, cfg config.Database, migrate bool) (*sql.DB, error) {
+	db, err := open("postgres", cfg.DSN(), semconv.DBSystemPostgreSQL)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	connectCtx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+	if err := Connect(connectCtx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if migrate {
+		if err := Migrate(ctx, db, Postgres); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
 	return db, nil
 }
+
+// Connect pings db until it answers, backing off exponentially between
+// attempts. It gives up with the last ping error once ctx is done.
+func Connect(ctx context.Context, db *sql.DB) error {
+	delay := minRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("connecting to database", "attempt", attempt, "retry_in", delay.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
+
+// open opens a database through driverName whose statements are traced, as
+// children of the span in the context they run with.
+func open(driverName, dsn string, system attribute.KeyValue) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitConnectorConnect: true,
+			OmitRows:             true,
+		}),
+	)
+}
@@ -0,0 +1,73 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectRetriesUntilPingSucceeds(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	refused := errors.New("connection refused")
+	mock.ExpectPing().WillReturnError(refused)
+	mock.ExpectPing().WillReturnError(refused)
+	mock.ExpectPing()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, storage.Connect(ctx, db))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConnectGivesUpAtDeadline(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	refused := errors.New("connection refused")
+	for i := 0; i < 10; i++ {
+		mock.ExpectPing().WillReturnError(refused)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, storage.Connect(ctx, db), refused)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestMonitorTracksPings(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := storage.NewMonitor(db, 50*time.Millisecond)
+	assert.Error(t, m.Err(), "unknown before the first check")
+
+	down := errors.New("connection reset")
+	mock.ExpectPing().WillReturnError(down)
+	mock.ExpectPing()
+	for i := 0; i < 100; i++ {
+		mock.ExpectPing()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return errors.Is(m.Err(), down) }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return m.Err() == nil }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNotFound = errors.New("Record not found")
+	ErrConflict = errors.New("Record conflicts with the current state, please retry")
+)
+
+// InvalidError reports input that was rejected before or while being stored.
+// Handlers answer it with 400 Bad Request.
+type InvalidError struct {
+	Message string
+}
+
+func (e *InvalidError) Error() string {
+	return e.Message
+}
+
+// Invalid returns an *InvalidError carrying message.
+func Invalid(message string) error {
+	return &InvalidError{Message: message}
+}
+
+// WithTx runs fn inside a transaction. The transaction is committed when fn
+// returns nil and rolled back otherwise, so the statements issued by fn take
+// effect as a unit. Database errors are translated with TranslateError.
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return TranslateError(err)
+	}
+	return TranslateError(tx.Commit())
+}
+
+// TranslateError maps PostgreSQL constraint and concurrency errors onto the
+// errors of this package. Other errors are returned unchanged.
+func TranslateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case "23503":
+		return Invalid("Foreign key constraint violation")
+	case "23514", "23502", "22001":
+		return Invalid("Value violates a constraint: " + pqErr.Message)
+	case "23505":
+		return ErrConflict
+	case "40001", "40P01":
+		return ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package storage_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTxCommits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM movies").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = storage.WithTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM movies WHERE id = $1", 1)
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO actor_movie").WillReturnError(&pq.Error{Code: "23503"})
+	mock.ExpectRollback()
+
+	err = storage.WithTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO actor_movie (actor_id, movie_id) VALUES ($1, $2)", 1, 2)
+		return err
+	})
+
+	var invalid *storage.InvalidError
+	assert.True(t, errors.As(err, &invalid))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTranslateError(t *testing.T) {
+	other := errors.New("connection reset")
+
+	assert.ErrorIs(t, storage.TranslateError(&pq.Error{Code: "23505"}), storage.ErrConflict)
+	assert.ErrorIs(t, storage.TranslateError(&pq.Error{Code: "40001"}), storage.ErrConflict)
+	assert.Equal(t, other, storage.TranslateError(other))
+	assert.Nil(t, storage.TranslateError(nil))
+}
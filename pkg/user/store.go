@@ -0,0 +1,55 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/pkg/query"
+)
+
+// UserStore persists the accounts and the invites to register, and looks up
+// the roles they are given. Implementations report a missing account with
+// storage.ErrNotFound, a taken username with storage.ErrConflict and rejected
+// input with a *storage.InvalidError.
+type UserStore interface {
+	auth.UserStore
+	auth.RoleStore
+	// ListUsers returns one page of accounts ordered by ID.
+	ListUsers(ctx context.Context, q UserQuery) (UserList, error)
+	// CreateUser stores a new account and returns it with its ID. If invite
+	// is not empty, the invite with that hash is used up as part of the same
+	// unit of work and its role given to the account; an unknown, used or
+	// expired invite is rejected.
+	CreateUser(ctx context.Context, u auth.User, invite string) (auth.User, error)
+	// UpdateUser loads the account with the given ID, passes it to update and
+	// saves the result, as one unit of work. An error returned by update
+	// aborts the operation.
+	UpdateUser(ctx context.Context, id int, update func(u *auth.User) error) (auth.User, error)
+	// RevokeUserTokens revokes every refresh token of the account.
+	RevokeUserTokens(ctx context.Context, userID int) error
+	SaveInvite(ctx context.Context, i Invite) error
+}
+
+// Invite lets whoever holds its code register one account with Role until
+// ExpiresAt. Only the SHA-256 hash of the code is stored.
+type Invite struct {
+	Hash      string
+	Role      int
+	CreatedBy int
+	ExpiresAt time.Time
+}
+
+// UserQuery selects the accounts returned by ListUsers.
+type UserQuery struct {
+	Page query.Page
+}
+
+// UserList is a page of accounts together with the total number of accounts.
+type UserList struct {
+	Users []auth.User
+	Total int
+	// More reports whether there are more accounts past the page, in the
+	// direction the page was read.
+	More bool
+}
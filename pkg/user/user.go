@@ -0,0 +1,457 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/query"
+	"github.com/axywe/filmotheka_vk/pkg/storage"
+	"github.com/axywe/filmotheka_vk/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account is an account as shown by the API, without its password.
+type Account struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Role     int    `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+func accountOf(u auth.User) Account {
+	return Account{ID: u.ID, Username: u.Username, Role: u.Role, Disabled: u.Disabled}
+}
+
+type Registration struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// InviteCode is required while registration is invite-only. The account
+	// is given the role of the invite.
+	InviteCode string `json:"inviteCode,omitempty"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// AccountPatch is a JSON merge patch (RFC 7396) for an account. Members left
+// out of the patch keep their value.
+type AccountPatch struct {
+	Role     util.Optional[int]  `json:"role" swaggertype:"integer"`
+	Disabled util.Optional[bool] `json:"disabled" swaggertype:"boolean"`
+}
+
+type InviteRequest struct {
+	// Role is the role of the account registered with the invite, viewer
+	// if left out.
+	Role int `json:"role,omitempty"`
+}
+
+type InviteResponse struct {
+	Code      string    `json:"code"`
+	Role      int       `json:"role"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type Handler struct {
+	store        UserStore
+	registration string
+	inviteTTL    time.Duration
+}
+
+// NewHandler returns a handler registering accounts as allowed by
+// cfg.Registration.
+func NewHandler(store UserStore, cfg config.Auth) *Handler {
+	return &Handler{store: store, registration: cfg.Registration, inviteTTL: cfg.InviteTTL}
+}
+
+func validateUsername(username string) error {
+	if n := len([]rune(username)); n < 3 || n > 50 {
+		return storage.Invalid("Username must be between 3 and 50 characters")
+	}
+	if strings.IndexFunc(username, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) }) >= 0 {
+		return storage.Invalid("Username cannot contain spaces or control characters")
+	}
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of password, which bcrypt limits to
+// 72 bytes.
+func hashPassword(password string) (string, error) {
+	if len([]rune(password)) < 8 || len(password) > 72 {
+		return "", storage.Invalid("Password must be at least 8 characters and at most 72 bytes long")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkGrantable verifies that the role with the given ID exists and that the
+// account of claims may hand it out.
+func (h *Handler) checkGrantable(ctx context.Context, claims *tokens.Claims, id int) error {
+	role, err := h.store.GetRole(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.Invalid("Unknown role")
+	}
+	if err != nil {
+		return err
+	}
+	return auth.CheckWithinOwn(ctx, h.store, claims.Role, role)
+}
+
+// checkManageable verifies that the account of claims may change u, the
+// account as read by UpdateUser: its current role cannot grant permissions
+// beyond own, the role of the caller, or the caller could demote or disable
+// someone more privileged. Stores cannot be called back during UpdateUser, so
+// the role of u is looked up beforehand as role; if u no longer has that role
+// the account changed meanwhile and the update is rejected as a conflict.
+func checkManageable(own, role auth.Role, u auth.User) error {
+	if u.Role != role.ID {
+		return storage.ErrConflict
+	}
+	if !own.Covers(role) {
+		return auth.ErrBeyondOwn
+	}
+	return nil
+}
+
+// sendError responds to a failed operation with the matching status code.
+func sendError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *storage.InvalidError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		util.SendJSONError(w, r, "User not found", http.StatusNotFound)
+	case errors.As(err, &invalid):
+		util.SendJSONError(w, r, invalid.Message, http.StatusBadRequest)
+	case errors.Is(err, storage.ErrConflict):
+		util.SendJSONError(w, r, err.Error(), http.StatusConflict)
+	case errors.Is(err, auth.ErrBeyondOwn):
+		util.SendJSONError(w, r, "Cannot grant permissions beyond your own", http.StatusForbidden)
+	default:
+		util.SendJSONError(w, r, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// @Summary Register an account
+// @Description Creates an account with the viewer role, or the role of the invite. While registration is
+// @Description invite-only, an invite code created with the users:invite permission is required.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param registration body Registration true "Username, password and invite code"
+// @Success 201 {object} Account "Account created"
+// @Failure 400 {object} util.ErrorResponse "Invalid input data or invite code"
+// @Failure 403 {object} util.ErrorResponse "Registration requires an invite"
+// @Failure 409 {object} util.ErrorResponse "Username already taken"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /users [post]
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var reg Registration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.registration == "invite" && reg.InviteCode == "" {
+		util.SendJSONError(w, r, "Registration requires an invite code", http.StatusForbidden)
+		return
+	}
+	if err := validateUsername(reg.Username); err != nil {
+		sendError(w, r, err)
+		return
+	}
+	hash, err := hashPassword(reg.Password)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	var invite string
+	if reg.InviteCode != "" {
+		invite = auth.HashToken(reg.InviteCode)
+	}
+	created, err := h.store.CreateUser(r.Context(), auth.User{Username: reg.Username, Password: hash, Role: auth.RoleViewer}, invite)
+	if errors.Is(err, storage.ErrConflict) {
+		util.SendJSONError(w, r, "Username already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, accountOf(created), http.StatusCreated)
+}
+
+// @Summary Get the current account
+// @Security ApiKeyAuth
+// @Tags Users
+// @Produce json
+// @Success 200 {object} Account "Account of the token"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 404 {object} util.ErrorResponse "User not found"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /users/me [get]
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+
+	u, err := h.store.GetUserByID(r.Context(), claims.UserID())
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, accountOf(u), http.StatusOK)
+}
+
+// @Summary Change the password of the current account
+// @Description Replaces the password and revokes every refresh token of the account, ending its other sessions
+// @Description once their access tokens expire.
+// @Security ApiKeyAuth
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param passwords body PasswordChange true "Current and new password"
+// @Success 200 {string} string "Password changed"
+// @Failure 400 {object} util.ErrorResponse "Invalid input data"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Wrong current password"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /users/me/password [put]
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+
+	var change PasswordChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := hashPassword(change.NewPassword)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	errWrongPassword := errors.New("wrong password")
+	_, err = h.store.UpdateUser(r.Context(), claims.UserID(), func(u *auth.User) error {
+		if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(change.CurrentPassword)) != nil {
+			return errWrongPassword
+		}
+		u.Password = hash
+		return nil
+	})
+	if errors.Is(err, errWrongPassword) {
+		util.SendJSONError(w, r, "Wrong current password", http.StatusForbidden)
+		return
+	}
+	if err == nil {
+		err = h.store.RevokeUserTokens(r.Context(), claims.UserID())
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, "Password changed", http.StatusOK)
+}
+
+// @Summary Get list of accounts
+// @Security ApiKeyAuth
+// @Tags Users
+// @Produce json
+// @Param limit query int false "Page size, from 1 to 100"
+// @Param offset query int false "Number of accounts to skip"
+// @Param cursor query string false "Opaque cursor taken from the Link header of a previous page"
+// @Success 200 {array} Account "List of accounts"
+// @Header 200 {integer} X-Total-Count "Total number of accounts"
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Failure 400 {object} util.ErrorResponse "Invalid pagination parameters"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /users [get]
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	page, err := query.ParsePage(r.URL.Query())
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if page.Cursor != nil && (page.Cursor.SortBy != "id" || page.Cursor.Desc) {
+		util.SendJSONError(w, r, "Cursor does not match the requested sort order", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.store.ListUsers(r.Context(), UserQuery{Page: page})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	accounts := make([]Account, 0, len(list.Users))
+	for _, u := range list.Users {
+		accounts = append(accounts, accountOf(u))
+	}
+	var first, last *query.Cursor
+	if len(accounts) > 0 {
+		first = &query.Cursor{SortBy: "id", ID: accounts[0].ID, Before: true}
+		last = &query.Cursor{SortBy: "id", ID: accounts[len(accounts)-1].ID}
+	}
+	next, prev := page.Neighbours(list.Total, list.More, first, last)
+	util.SetPaginationHeaders(w, r, list.Total, next, prev)
+	util.SendJSONResponse(w, r, accounts, http.StatusOK)
+}
+
+// @Summary Change the role of an account or disable it
+// @Description Applies a JSON merge patch (RFC 7396) to the role and the disabled flag of an account. Disabling
+// @Description an account revokes its refresh tokens; its access tokens stay valid until they expire.
+// @Description Nobody can change their own role, disable themselves, grant a role with permissions they
+// @Description do not have or change an account whose role has such permissions.
+// @Security ApiKeyAuth
+// @Tags Users
+// @Accept json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param account body AccountPatch true "Members to change"
+// @Success 200 {object} Account "Account as stored"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action or role beyond your own"
+// @Failure 404 {object} util.ErrorResponse "User not found"
+// @Failure 409 {object} util.ErrorResponse "Account changed concurrently, please retry"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /users/{id} [patch]
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := util.PathID(r)
+	if err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+
+	var patch AccountPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.Role.Null || patch.Disabled.Null {
+		util.SendJSONError(w, r, "Role and disabled cannot be null", http.StatusBadRequest)
+		return
+	}
+	if id == claims.UserID() && (patch.Role.Set && patch.Role.Value != claims.Role || patch.Disabled.Value) {
+		util.SendJSONError(w, r, "Accounts cannot change their own role or disable themselves", http.StatusBadRequest)
+		return
+	}
+	own, err := auth.LoadRole(r.Context(), h.store, claims.Role)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	target, err := h.store.GetUserByID(r.Context(), id)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	targetRole, err := auth.LoadRole(r.Context(), h.store, target.Role)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	if patch.Role.Set {
+		if err := h.checkGrantable(r.Context(), claims, patch.Role.Value); err != nil {
+			sendError(w, r, err)
+			return
+		}
+	}
+
+	saved, err := h.store.UpdateUser(r.Context(), id, func(u *auth.User) error {
+		if err := checkManageable(own, targetRole, *u); err != nil {
+			return err
+		}
+		if patch.Role.Set {
+			u.Role = patch.Role.Value
+		}
+		if patch.Disabled.Set {
+			u.Disabled = patch.Disabled.Value
+		}
+		return nil
+	})
+	if err == nil && saved.Disabled {
+		err = h.store.RevokeUserTokens(r.Context(), id)
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, accountOf(saved), http.StatusOK)
+}
+
+// @Summary Create an invite
+// @Description Returns a code with which one account can be registered with the given role until the invite
+// @Description expires. Only the hash of the code is stored: it cannot be shown again. The role cannot grant
+// @Description permissions beyond those of the caller.
+// @Security ApiKeyAuth
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param invite body InviteRequest false "Role of the invited account"
+// @Success 201 {object} InviteResponse "Invite created"
+// @Failure 400 {object} util.ErrorResponse "Bad request"
+// @Failure 401 {object} util.ErrorResponse "Not authorized"
+// @Failure 403 {object} util.ErrorResponse "Not authorized for this action or role beyond your own"
+// @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Router /users/invites [post]
+func (h *Handler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	claims, ok := tokens.FromContext(r.Context())
+	if !ok {
+		util.SendJSONError(w, r, "No token provided", http.StatusUnauthorized)
+		return
+	}
+
+	var req InviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		util.SendJSONError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Role == 0 {
+		req.Role = auth.RoleViewer
+	}
+	if err := h.checkGrantable(r.Context(), claims, req.Role); err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	code, err := tokens.NewID()
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	invite := Invite{
+		Hash:      auth.HashToken(code),
+		Role:      req.Role,
+		CreatedBy: claims.UserID(),
+		ExpiresAt: time.Now().Add(h.inviteTTL).UTC(),
+	}
+	if err := h.store.SaveInvite(r.Context(), invite); err != nil {
+		sendError(w, r, err)
+		return
+	}
+	util.SendJSONResponse(w, r, InviteResponse{Code: code, Role: invite.Role, ExpiresAt: invite.ExpiresAt}, http.StatusCreated)
+}
@@ -0,0 +1,318 @@
+package user_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/axywe/filmotheka_vk/internal/auth"
+	"github.com/axywe/filmotheka_vk/internal/config"
+	"github.com/axywe/filmotheka_vk/internal/tokens"
+	"github.com/axywe/filmotheka_vk/pkg/storage/memory"
+	"github.com/axywe/filmotheka_vk/pkg/user"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ctx = context.Background()
+
+var (
+	openRegistration   = config.Auth{Registration: "open", InviteTTL: time.Hour}
+	inviteRegistration = config.Auth{Registration: "invite", InviteTTL: time.Hour}
+)
+
+// serve sends a request with body to h, as the user userID with role unless
+// userID is zero, and decodes the response into out if it is not nil.
+func serve(t *testing.T, h http.HandlerFunc, method, target string, body interface{}, userID, role int, out interface{}) int {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Unable to marshal body: %v", err)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(raw))
+	if userID != 0 {
+		claims := &tokens.Claims{Role: role, RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(userID)}}
+		req = req.WithContext(tokens.NewContext(req.Context(), claims))
+	}
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	if out != nil {
+		if err := json.Unmarshal(rr.Body.Bytes(), out); err != nil {
+			t.Fatalf("Unable to unmarshal response %q: %v", rr.Body.String(), err)
+		}
+	}
+	return rr.Code
+}
+
+// addAdmin stores an administrator and returns their ID.
+func addAdmin(t *testing.T, store *memory.Store) int {
+	t.Helper()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("adminpass"), bcrypt.MinCost)
+	admin, err := store.AddUser(ctx, auth.User{Username: "admin", Password: string(hash), Role: auth.RoleAdmin})
+	if err != nil {
+		t.Fatalf("Unable to add admin: %v", err)
+	}
+	return admin.ID
+}
+
+func TestRegisterOpen(t *testing.T) {
+	store := memory.New()
+	h := user.NewHandler(store, openRegistration)
+
+	var account user.Account
+	status := serve(t, h.Register, http.MethodPost, "/users", user.Registration{Username: "alice", Password: "wonderland"}, 0, 0, &account)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v", status)
+	}
+	if account.ID == 0 || account.Username != "alice" || account.Role != auth.RoleViewer || account.Disabled {
+		t.Errorf("Unexpected account %+v", account)
+	}
+	stored, err := store.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Account not stored: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("wonderland")) != nil {
+		t.Errorf("The password is not stored as its bcrypt hash")
+	}
+
+	tests := []struct {
+		name           string
+		registration   user.Registration
+		expectedStatus int
+	}{
+		{"TakenUsername", user.Registration{Username: "alice", Password: "wonderland"}, http.StatusConflict},
+		{"ShortUsername", user.Registration{Username: "al", Password: "wonderland"}, http.StatusBadRequest},
+		{"UsernameWithSpace", user.Registration{Username: "al ice", Password: "wonderland"}, http.StatusBadRequest},
+		{"ShortPassword", user.Registration{Username: "bob", Password: "short"}, http.StatusBadRequest},
+		{"UnknownInvite", user.Registration{Username: "bob", Password: "wonderland", InviteCode: "unknown"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := serve(t, h.Register, http.MethodPost, "/users", test.registration, 0, 0, nil); status != test.expectedStatus {
+				t.Errorf("Expected status %v, got %v", test.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestRegisterWithInvite(t *testing.T) {
+	store := memory.New()
+	adminID := addAdmin(t, store)
+	h := user.NewHandler(store, inviteRegistration)
+
+	reg := user.Registration{Username: "carol", Password: "password123"}
+	if status := serve(t, h.Register, http.MethodPost, "/users", reg, 0, 0, nil); status != http.StatusForbidden {
+		t.Fatalf("Expected status 403 without an invite, got %v", status)
+	}
+
+	var invite user.InviteResponse
+	status := serve(t, h.CreateInvite, http.MethodPost, "/users/invites", user.InviteRequest{Role: auth.RoleAdmin}, adminID, auth.RoleAdmin, &invite)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v", status)
+	}
+	if invite.Code == "" || invite.Role != auth.RoleAdmin || !invite.ExpiresAt.After(time.Now()) {
+		t.Errorf("Unexpected invite %+v", invite)
+	}
+
+	reg.InviteCode = invite.Code
+	var account user.Account
+	if status := serve(t, h.Register, http.MethodPost, "/users", reg, 0, 0, &account); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 with an invite, got %v", status)
+	}
+	if account.Role != auth.RoleAdmin {
+		t.Errorf("Expected the role of the invite, got %v", account.Role)
+	}
+
+	reg.Username = "dave"
+	if status := serve(t, h.Register, http.MethodPost, "/users", reg, 0, 0, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a used invite, got %v", status)
+	}
+}
+
+func TestMeAndChangePassword(t *testing.T) {
+	store := memory.New()
+	h := user.NewHandler(store, openRegistration)
+	var account user.Account
+	serve(t, h.Register, http.MethodPost, "/users", user.Registration{Username: "erin", Password: "password123"}, 0, 0, &account)
+	if err := store.SaveRefreshToken(ctx, auth.RefreshToken{Hash: "hash", FamilyID: "family", UserID: account.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Unable to save refresh token: %v", err)
+	}
+
+	var me user.Account
+	if status := serve(t, h.Me, http.MethodGet, "/users/me", nil, account.ID, auth.RoleViewer, &me); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", status)
+	}
+	if me != account {
+		t.Errorf("Expected %+v, got %+v", account, me)
+	}
+	if status := serve(t, h.Me, http.MethodGet, "/users/me", nil, 0, 0, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %v", status)
+	}
+
+	wrong := user.PasswordChange{CurrentPassword: "wrong password", NewPassword: "new password"}
+	if status := serve(t, h.ChangePassword, http.MethodPut, "/users/me/password", wrong, account.ID, auth.RoleViewer, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a wrong password, got %v", status)
+	}
+	change := user.PasswordChange{CurrentPassword: "password123", NewPassword: "new password"}
+	if status := serve(t, h.ChangePassword, http.MethodPut, "/users/me/password", change, account.ID, auth.RoleViewer, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", status)
+	}
+	stored, _ := store.GetUserByID(ctx, account.ID)
+	if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("new password")) != nil {
+		t.Errorf("The password was not changed")
+	}
+	if token, _ := store.UseRefreshToken(ctx, "hash"); !token.Revoked {
+		t.Errorf("The refresh tokens of the account were not revoked")
+	}
+}
+
+func TestAdministration(t *testing.T) {
+	store := memory.New()
+	adminID := addAdmin(t, store)
+	h := user.NewHandler(store, openRegistration)
+	var account user.Account
+	serve(t, h.Register, http.MethodPost, "/users", user.Registration{Username: "frank", Password: "password123"}, 0, 0, &account)
+
+	update := func(id int, patch string, out interface{}) int {
+		req := httptest.NewRequest(http.MethodPatch, "/users/"+strconv.Itoa(id), bytes.NewBufferString(patch))
+		req.SetPathValue("id", strconv.Itoa(id))
+		claims := &tokens.Claims{Role: auth.RoleAdmin, RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(adminID)}}
+		req = req.WithContext(tokens.NewContext(req.Context(), claims))
+		rr := httptest.NewRecorder()
+		h.Update(rr, req)
+		if out != nil {
+			json.Unmarshal(rr.Body.Bytes(), out)
+		}
+		return rr.Code
+	}
+
+	var updated user.Account
+	if status := update(account.ID, `{"role": 1, "disabled": true}`, &updated); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", status)
+	}
+	if updated.Role != auth.RoleAdmin || !updated.Disabled || updated.Username != "frank" {
+		t.Errorf("Unexpected account %+v", updated)
+	}
+
+	tests := []struct {
+		name           string
+		id             int
+		patch          string
+		expectedStatus int
+	}{
+		{"UnknownRole", account.ID, `{"role": 99}`, http.StatusBadRequest},
+		{"NullRole", account.ID, `{"role": null}`, http.StatusBadRequest},
+		{"UnknownUser", account.ID + 1, `{"disabled": true}`, http.StatusNotFound},
+		{"DemoteSelf", adminID, `{"role": 2}`, http.StatusBadRequest},
+		{"DisableSelf", adminID, `{"disabled": true}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := update(test.id, test.patch, nil); status != test.expectedStatus {
+				t.Errorf("Expected status %v, got %v", test.expectedStatus, status)
+			}
+		})
+	}
+
+	// A moderator may hand out editor invites, not administrator ones.
+	const moderator, editor = 4, 3
+	if status := serve(t, h.CreateInvite, http.MethodPost, "/users/invites", user.InviteRequest{Role: editor}, account.ID, moderator, nil); status != http.StatusCreated {
+		t.Errorf("Expected status 201 for a role within the own one, got %v", status)
+	}
+	if status := serve(t, h.CreateInvite, http.MethodPost, "/users/invites", user.InviteRequest{Role: auth.RoleAdmin}, account.ID, moderator, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a role beyond the own one, got %v", status)
+	}
+
+	var accounts []user.Account
+	if status := serve(t, h.List, http.MethodGet, "/users?limit=1", nil, adminID, auth.RoleAdmin, &accounts); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", status)
+	}
+	if len(accounts) != 1 || accounts[0].ID != adminID {
+		t.Errorf("Expected the first account only, got %+v", accounts)
+	}
+}
+
+func TestUpdateBeyondOwn(t *testing.T) {
+	store := memory.New()
+	adminID := addAdmin(t, store)
+	h := user.NewHandler(store, openRegistration)
+	var account user.Account
+	serve(t, h.Register, http.MethodPost, "/users", user.Registration{Username: "grace", Password: "password123"}, 0, 0, &account)
+	manager, err := store.CreateRole(ctx, auth.Role{Name: "manager", Permissions: []auth.Permission{auth.MoviesRead, auth.ActorsRead, auth.UsersRead, auth.UsersWrite}})
+	if err != nil {
+		t.Fatalf("Unable to create role: %v", err)
+	}
+
+	update := func(id int, patch string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/users/"+strconv.Itoa(id), bytes.NewBufferString(patch))
+		req.SetPathValue("id", strconv.Itoa(id))
+		claims := &tokens.Claims{Role: manager.ID, RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(account.ID)}}
+		req = req.WithContext(tokens.NewContext(req.Context(), claims))
+		rr := httptest.NewRecorder()
+		h.Update(rr, req)
+		return rr.Code
+	}
+
+	// The manager role lacks permissions of the admin role, so a manager can
+	// neither demote nor disable an administrator.
+	if status := update(adminID, `{"role": 2}`); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 demoting an administrator, got %v", status)
+	}
+	if status := update(adminID, `{"disabled": true}`); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 disabling an administrator, got %v", status)
+	}
+	if admin, _ := store.GetUserByID(ctx, adminID); admin.Role != auth.RoleAdmin || admin.Disabled {
+		t.Errorf("The administrator was changed: %+v", admin)
+	}
+
+	var viewer user.Account
+	serve(t, h.Register, http.MethodPost, "/users", user.Registration{Username: "heidi", Password: "password123"}, 0, 0, &viewer)
+	if status := update(viewer.ID, `{"disabled": true}`); status != http.StatusOK {
+		t.Errorf("Expected status 200 disabling a viewer, got %v", status)
+	}
+}
+
+// promotingStore promotes the account it updates to administrator right
+// before the update reads it, as a concurrent request would.
+type promotingStore struct {
+	*memory.Store
+}
+
+func (s promotingStore) UpdateUser(ctx context.Context, id int, update func(u *auth.User) error) (auth.User, error) {
+	s.Store.UpdateUser(ctx, id, func(u *auth.User) error {
+		u.Role = auth.RoleAdmin
+		return nil
+	})
+	return s.Store.UpdateUser(ctx, id, update)
+}
+
+func TestUpdateRoleChangedConcurrently(t *testing.T) {
+	store := memory.New()
+	h := user.NewHandler(store, openRegistration)
+	var viewer user.Account
+	serve(t, h.Register, http.MethodPost, "/users", user.Registration{Username: "ivan", Password: "password123"}, 0, 0, &viewer)
+	manager, err := store.CreateRole(ctx, auth.Role{Name: "manager", Permissions: []auth.Permission{auth.MoviesRead, auth.ActorsRead, auth.UsersRead, auth.UsersWrite}})
+	if err != nil {
+		t.Fatalf("Unable to create role: %v", err)
+	}
+
+	h = user.NewHandler(promotingStore{store}, openRegistration)
+	req := httptest.NewRequest(http.MethodPatch, "/users/"+strconv.Itoa(viewer.ID), bytes.NewBufferString(`{"disabled": true}`))
+	req.SetPathValue("id", strconv.Itoa(viewer.ID))
+	claims := &tokens.Claims{Role: manager.ID, RegisteredClaims: jwt.RegisteredClaims{Subject: strconv.Itoa(viewer.ID + 1)}}
+	req = req.WithContext(tokens.NewContext(req.Context(), claims))
+	rr := httptest.NewRecorder()
+	h.Update(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for an account promoted meanwhile, got %v", rr.Code)
+	}
+	if stored, _ := store.GetUserByID(ctx, viewer.ID); stored.Disabled {
+		t.Errorf("The account promoted meanwhile was disabled: %+v", stored)
+	}
+}
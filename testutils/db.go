@@ -4,25 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"testing"
-)
-
-func SetupDB(t *testing.T) *sql.DB {
-	const (
-		host     = "localhost"
-		port     = 5432
-		user     = "filmotheka_user"
-		password = "filmotheka_pass"
-		dbname   = "filmotheka_db"
-	)
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
 
-	db, err := sql.Open("postgres", psqlInfo)
-	if err != nil {
-		t.Fatalf("Unable to connect to database: %v", err)
-	}
-
-	return db
-}
+	_ "github.com/lib/pq"
+)
 
 func BrokenSetupDB(t *testing.T) *sql.DB {
 	const (
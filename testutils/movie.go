@@ -1,11 +1,9 @@
 package testutils_test
 
 import (
-	"database/sql"
 	"testing"
 
 	movie "github.com/axywe/filmotheka_vk/pkg/movie"
-	_ "github.com/lib/pq"
 
 	"bytes"
 	"encoding/json"
@@ -13,8 +11,8 @@ import (
 	"net/http/httptest"
 )
 
-func CreateMovie(t *testing.T, db *sql.DB, movieDetails movie.Movie) int {
-	movieHandler := movie.NewHandler(db)
+func CreateMovie(t *testing.T, store movie.MovieStore, movieDetails movie.Movie) int {
+	movieHandler := movie.NewHandler(store)
 
 	body, err := json.Marshal(movieDetails)
 	if err != nil {
@@ -0,0 +1,14 @@
+package testutils_test
+
+import (
+	"testing"
+
+	"github.com/axywe/filmotheka_vk/pkg/storage/memory"
+)
+
+// SetupStore returns an empty in-memory store, so handler tests run without
+// a database server.
+func SetupStore(t *testing.T) *memory.Store {
+	t.Helper()
+	return memory.New()
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SetPaginationHeaders reports the size of a paginated listing in the
+// X-Total-Count header and links to the neighbouring pages in the Link header.
+// next and prev hold the query parameters that replace those of the current
+// request; a nil value means there is no such page.
+func SetPaginationHeaders(w http.ResponseWriter, r *http.Request, total int, next, prev url.Values) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	links := []string{}
+	if next != nil {
+		links = append(links, `<`+pageURL(r, next)+`>; rel="next"`)
+	}
+	if prev != nil {
+		links = append(links, `<`+pageURL(r, prev)+`>; rel="prev"`)
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageURL(r *http.Request, params url.Values) string {
+	values := r.URL.Query()
+	for _, key := range []string{"limit", "offset", "cursor"} {
+		values.Del(key)
+	}
+	for key, value := range params {
+		values[key] = value
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+	return u.String()
+}
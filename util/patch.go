@@ -0,0 +1,26 @@
+package util
+
+import "encoding/json"
+
+// Optional is a member of a JSON merge patch (RFC 7396). It tells apart a
+// member that is absent from the patch, one that is explicitly null and one
+// that carries a value.
+type Optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// HasValue reports whether the member is present with a non-null value.
+func (o Optional[T]) HasValue() bool {
+	return o.Set && !o.Null
+}
@@ -1,9 +1,12 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+
+	"github.com/axywe/filmotheka_vk/internal/logging"
 )
 
 type ErrorResponse struct {
@@ -11,26 +14,37 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// SendJSONError responds with an ErrorResponse. A server error raised after
+// the request ran out of time is reported as 504 Gateway Timeout, or as 503
+// Service Unavailable when the client gave up first.
 func SendJSONError(w http.ResponseWriter, r *http.Request, message string, code int) {
+	logger := logging.FromContext(r.Context())
+	if code >= http.StatusInternalServerError {
+		logger.Error("request failed", "status", code, "error", message)
+		switch err := r.Context().Err(); {
+		case errors.Is(err, context.DeadlineExceeded):
+			code, message = http.StatusGatewayTimeout, "Request timed out"
+		case errors.Is(err, context.Canceled):
+			code, message = http.StatusServiceUnavailable, "Request canceled"
+		}
+	} else {
+		logger.Debug("request rejected", "status", code, "error", message)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	errorResponse := ErrorResponse{
 		Code:    code,
 		Message: message,
 	}
-	log.Printf(`%d | %s | %s "%s" | %s`, code, r.RemoteAddr, r.Method, r.RequestURI, message)
-	err := json.NewEncoder(w).Encode(errorResponse)
-	if err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+	if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
+		logger.Warn("encoding JSON response", "error", err)
 	}
 }
 
 func SendJSONResponse(w http.ResponseWriter, r *http.Request, data interface{}, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	log.Printf(`%d | %s | %s "%s"`, code, r.RemoteAddr, r.Method, r.RequestURI)
-	err := json.NewEncoder(w).Encode(data)
-	if err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logging.FromContext(r.Context()).Warn("encoding JSON response", "error", err)
 	}
 }
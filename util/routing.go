@@ -0,0 +1,32 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+var ErrInvalidID = errors.New("ID must be a positive integer")
+
+// ParseID parses a resource ID taken from a request path, query or body.
+func ParseID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidID
+	}
+	return id, nil
+}
+
+// PathID returns the ID bound to the {id} wildcard of the matched route.
+func PathID(r *http.Request) (int, error) {
+	return ParseID(r.PathValue("id"))
+}
+
+// MarkDeprecated flags the response of a deprecated endpoint and, when
+// successor is not empty, links the endpoint that replaces it.
+func MarkDeprecated(w http.ResponseWriter, successor string) {
+	w.Header().Set("Deprecation", "true")
+	if successor != "" {
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+	}
+}